@@ -0,0 +1,224 @@
+package chord
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// ErrPermission is returned when a node is not allowed to read or write an object.
+var ErrPermission = errors.New("permission denied")
+
+const anyone = "*" // Principal that matches every node, including nodes without a verified certificate
+
+// ACL controls which nodes may read and write an object. Nodes are identified by principals, the
+// subject of the certificate they connect with, e.g. CN=ci-runner,O=builds. Principals are only
+// verified in cluster CA mode, so objects with an ACL can only be accessed by other nodes in that mode.
+// Objects without an ACL can be read and written by every node.
+type ACL struct {
+	Owner   string   // Owner may read and write the object and change its ACL
+	Readers []string // Readers may read the object
+	Writers []string // Writers may write and delete the object, and read its metadata
+}
+
+// Returns the principal of this node, the subject of its certificate. Empty without a cluster CA,
+// since the subject of a certificate that is not signed by the CA proves nothing.
+func Principal() string {
+	if clusterCA == nil {
+		return ""
+	}
+	cert, err := certificates.certificate()
+	if err != nil || cert.Leaf == nil {
+		return ""
+	}
+	return cert.Leaf.Subject.String()
+}
+
+// Returns the ACL of new objects stored by this node: owned by this node and readable by anyone.
+// Without a cluster CA new objects have no ACL.
+func DefaultACL() *ACL {
+	principal := Principal()
+	if principal == "" {
+		return nil
+	}
+	return &ACL{Owner: principal, Readers: []string{anyone}}
+}
+
+// Checks if a principal may read the contents of an object.
+func (acl *ACL) CanRead(principal string) bool {
+	return acl == nil || acl.isOwner(principal) || matches(acl.Readers, principal)
+}
+
+// Checks if a principal may write an object.
+func (acl *ACL) CanWrite(principal string) bool {
+	return acl == nil || acl.isOwner(principal) || matches(acl.Writers, principal)
+}
+
+// Checks if a principal may read the metadata of an object. Writers need the metadata to write the
+// next version of the object.
+func (acl *ACL) CanStat(principal string) bool {
+	return acl.CanRead(principal) || acl.CanWrite(principal)
+}
+
+func (acl *ACL) isOwner(principal string) bool {
+	return principal != "" && acl.Owner == principal
+}
+
+// Checks if a list of principals contains a principal or anyone.
+func matches(principals []string, principal string) bool {
+	return slices.Contains(principals, anyone) || (principal != "" && slices.Contains(principals, principal))
+}
+
+// Checks if two ACLs are the same.
+func (acl *ACL) equal(other *ACL) bool {
+	if acl == nil || other == nil {
+		return acl == other
+	}
+	return acl.Owner == other.Owner && slices.Equal(acl.Readers, other.Readers) && slices.Equal(acl.Writers, other.Writers)
+}
+
+// Checks that a principal may write an incoming version of an object over the stored version, if
+// any. Writing requires write permission on the stored version, and changing the ACL requires being
+// its owner. An object without an ACL can only be given one that is owned by the writer.
+func authorizeWrite(principal string, stored *ObjectInfo, incoming ObjectInfo) error {
+	var current *ACL
+	if stored != nil {
+		current = stored.ACL
+	}
+	if stored == nil && !incoming.ACL.CanWrite(principal) {
+		return fmt.Errorf("%w: %s may not create %s", ErrPermission, principal, incoming.Key)
+	}
+	if !current.CanWrite(principal) {
+		return fmt.Errorf("%w: %s may not write %s", ErrPermission, principal, incoming.Key)
+	}
+	if stored != nil && !current.equal(incoming.ACL) {
+		owner := incoming.ACL
+		if current != nil {
+			owner = current
+		}
+		if owner == nil || !owner.isOwner(principal) {
+			return fmt.Errorf("%w: %s may not change the ACL of %s", ErrPermission, principal, incoming.Key)
+		}
+	}
+	return nil
+}
+
+// Replaces the ACL of a file. Only the owner of the file may change its ACL, and an object without
+// an ACL can be claimed by giving it an ACL owned by this node.
+func (node *Node) SetACL(path string, acl ACL) ([]ReplicaResult, error) {
+	data, info, err := node.getObject(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	replicas, err := node.replicas(path)
+	if err != nil {
+		return nil, err
+	}
+	// The parts are protected first, so that the file never has an ACL its parts do not enforce
+	if info.Manifest {
+		err = node.setPartsACL(path, data, acl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node.writeQuorum(replicas, info.withACL(acl, node.Address), data)
+}
+
+// Gives the chunks and fragments of a file a new ACL. Chunks stored under their content key may be
+// chunks of other files too, so a file stored in them cannot be given an ACL. Lost fragments are
+// skipped, they are regenerated with the ACL of the file.
+func (node *Node) setPartsACL(path string, encoded []byte, acl ACL) error {
+	manifest, err := decodeManifest(encoded)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Chunks) > 0 && !manifest.Private {
+		return fmt.Errorf("the chunks of %s are shared with other files, store it again to give it an ACL", path)
+	}
+	for i := range manifest.Chunks {
+		_, err = node.SetACL(manifest.chunkKey(path, i), acl)
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	for i, fragment := range manifest.Fragments {
+		data, info, err := TLSGet(fragment.Node, fragmentKey(path, i), 0)
+		if err == nil {
+			err = TLSSend(fragment.Node, info.withACL(acl, node.Address), data)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("fragment %d on %s: %w", i, fragment.Node.TLSAddress, err)
+		}
+	}
+	return nil
+}
+
+// Returns the next version of an object with a new ACL, written by the node at uploader.
+func (info ObjectInfo) withACL(acl ACL, uploader string) ObjectInfo {
+	info.ACL = &acl
+	info.Modified = time.Now()
+	info.Uploader = uploader
+	info.Version++
+	info.Vector = info.CausalVector().Increment(uploader)
+	info.Siblings = nil
+	return info
+}
+
+// Deletes a file from the ring by replacing it with a tombstone on its replicas. Deleting requires
+// write permission. The tombstone is removed like the tombstone of an expired file. The fragments of
+// an erasure coded file are deleted too, and the chunks of a chunked file are released.
+func (node *Node) DeleteFile(path string) ([]ReplicaResult, error) {
+	info, err := node.statObject(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	var manifest *Manifest
+	if info.Manifest {
+		encoded, _, err := node.getObject(path)
+		if err == nil {
+			var decoded Manifest
+			decoded, err = decodeManifest(encoded)
+			manifest = &decoded
+		}
+		if err != nil {
+			log.Printf("Failed to read the manifest of %s, its parts are left in place: %v\n", path, err)
+			manifest = nil
+		}
+	}
+
+	results, err := node.storeObject(info.deletedBy(node.Address), nil)
+	if err != nil || manifest == nil {
+		return results, err
+	}
+	// The file is deleted once its manifest is, parts that cannot be removed are only wasted space
+	if len(manifest.Fragments) > 0 {
+		err = node.deleteFragments(path, *manifest)
+	} else {
+		err = node.releaseChunks(path, *manifest)
+	}
+	if err != nil {
+		log.Printf("Failed to remove the parts of %s: %v\n", path, err)
+	}
+	return results, nil
+}
+
+// Returns the tombstone that replaces an object deleted by the node at uploader.
+func (info ObjectInfo) deletedBy(uploader string) ObjectInfo {
+	now := time.Now()
+	info.Deleted = true
+	info.Expires = now
+	info.Modified = now
+	info.Uploader = uploader
+	info.Manifest = false
+	info.Encryption = nil
+	info.Siblings = nil
+	return info
+}
@@ -0,0 +1,50 @@
+package chord
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const casPrefix = "cas/" // Prefix of content keys, followed by the hex encoded SHA-256 of the contents
+
+// Returns the content key of data. Objects stored under their content key are stored once no matter
+// how many times they are uploaded, and can be verified against their key on retrieval.
+func ContentKey(data []byte) string {
+	return casPrefix + checksum(data)
+}
+
+// Checks if a key is a content key.
+func isContentKey(key string) bool {
+	return strings.HasPrefix(key, casPrefix)
+}
+
+// Stores data under its content key and returns the key. If the contents are already stored in the
+// ring, nothing is uploaded and no replica results are returned, unless the stored contents expire
+// before the requested expiry and are stored again to extend it, or are a chunk whose references must
+// be dropped so that deleting the files it is a chunk of does not release it. The name is only used
+// as metadata.
+func (node *Node) StoreContent(name string, data []byte, opts StoreOptions) (string, []ReplicaResult, error) {
+	key := ContentKey(data)
+	info := node.newObjectInfo(key, data, opts)
+	info.Name = filepath.Base(name)
+	info.ContentType = contentType(name, data)
+	if previous, err := node.statObject(key); err == nil && previous.Checksum == checksum(data) {
+		if !expiresBefore(previous.Expires, opts.Expires) {
+			if len(previous.References) == 0 {
+				return key, nil, nil
+			}
+			info.Expires = previous.Expires
+		}
+	}
+	results, err := node.storeObject(info, data)
+	return key, results, err
+}
+
+// Verifies that data retrieved under a content key matches the key.
+func verifyContent(key string, data []byte) error {
+	if isContentKey(key) && ContentKey(data) != key {
+		return fmt.Errorf("contents of %s: %w", key, ErrChecksum)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package chord
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const certificateValidity = 365 * 24 * time.Hour // How long a generated certificate is valid
+
+// Sets the paths of the certificate and key the node presents on TLS connections.
+func SetCertificate(cert string, key string) {
+	certFile = cert
+	keyFile = key
+}
+
+// Generates an ECDSA key and a self-signed certificate for a node that has neither. In cluster CA
+// mode the certificate must be signed by the CA, so it is never generated.
+func EnsureCertificate(address string) error {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return nil
+	}
+	if !errors.Is(certErr, fs.ErrNotExist) || !errors.Is(keyErr, fs.ErrNotExist) {
+		return fmt.Errorf("need both a certificate and a key: %w", errors.Join(certErr, keyErr))
+	}
+	if clusterCA != nil {
+		return fmt.Errorf("no certificate at %s, cluster CA mode needs a certificate signed by the CA", certFile)
+	}
+
+	err := generateCertificate(address)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	log.Printf("Generated a self-signed certificate for %s in %s\n", address, certFile)
+	return nil
+}
+
+// Writes a new key and a self-signed certificate for a node address. The certificate is valid for
+// the host of the address, for 0.0.0.0 that TLS addresses are dialed at, and for the node's
+// chord:// URI. It is a leaf certificate that cannot sign others; peers trust it as it is.
+func generateCertificate(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "chord " + address},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		IPAddresses:           []net.IP{net.IPv4zero},
+		URIs:                  []*url.URL{{Scheme: nodeURIScheme, Host: address}},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else {
+		template.DNSNames = []string{host}
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = writePEM(keyFile, "PRIVATE KEY", keyDER, 0600)
+	if err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", cert, 0644)
+}
+
+// Writes a PEM encoded block to a file, creating its directory.
+func writePEM(path string, blockType string, der []byte, perm fs.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
@@ -0,0 +1,45 @@
+package chord
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	previousCert, previousKey := certFile, keyFile
+	SetCertificate(filepath.Join(dir, "certs", "cert.pem"), filepath.Join(dir, "certs", "key.pem"))
+	t.Cleanup(func() { SetCertificate(previousCert, previousKey) })
+
+	err := EnsureCertificate("10.0.0.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign != 0 {
+		t.Fatalf("generated certificate can sign certificates: IsCA %v, key usage %v", cert.IsCA, cert.KeyUsage)
+	}
+	err = verifyIdentity(cert, "10.0.0.1:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A peer trusts the certificate the node advertises as it is
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, DNSName: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("advertised certificate does not verify: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+const certWatchInterval = 10000 // Interval in milliseconds at which the certificate files are checked for changes
+
+// certStore holds the certificate of the node in memory. It is presented on every TLS connection
+// and replaced when the certificate files change, so certificates can be rotated without a restart.
+type certStore struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pem  []byte // pem is the PEM encoded certificate, advertised as the public key of the node
+}
+
+var certificates certStore
+
+// Reads the certificate files and replaces the certificate if it changed. The new certificate must
+// belong to the node at address, see verifyNodeRef, or the current certificate is kept. Returns true
+// if the certificate was replaced.
+func (s *certStore) load(address string) (bool, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	unchanged := bytes.Equal(certPEM, s.pem)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, err
+	}
+	err = verifyNodeRef(NodeRef{Address: address, PublicKey: certPEM})
+	if err != nil {
+		return false, fmt.Errorf("certificate does not match the node: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = &cert
+	s.pem = certPEM
+	return true, nil
+}
+
+// Returns the current certificate.
+func (s *certStore) certificate() (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cert == nil {
+		return nil, errors.New("no certificate loaded")
+	}
+	return s.cert, nil
+}
+
+// Returns the current certificate PEM encoded.
+func (s *certStore) publicKey() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pem
+}
+
+// Reloads the certificate of the node if the certificate files changed, and advertises the new
+// certificate as the public key of the node. Neighbours learn the new public key through Notify
+// and GetSuccessorList.
+func (node *Node) ReloadCertificate() {
+	changed, err := certificates.load(node.Address)
+	if err != nil {
+		log.Printf("Failed to reload certificate: %v\n", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	publicKey := certificates.publicKey()
+	node.PublicKey = publicKey
+	for i := range node.Successors {
+		// The node is its own successor with an empty address until it has joined a ring
+		if node.Successors[i].Address == node.Address || node.Successors[i].Address == "" {
+			node.Successors[i].PublicKey = publicKey
+		}
+	}
+	log.Printf("Reloaded certificate from %s\n", certFile)
+}
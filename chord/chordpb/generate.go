@@ -0,0 +1,5 @@
+// Package chordpb holds the protocol buffer messages and gRPC service of the Chord protocol,
+// generated from chord.proto.
+package chordpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative chord.proto
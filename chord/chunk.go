@@ -0,0 +1,222 @@
+package chord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	chunkParallelism  = 8 // Number of chunks transferred at the same time
+	manifestMediaType = "application/vnd.chord.manifest+json"
+)
+
+// Manifest is stored under the key of a file that was split into chunks or erasure coded fragments.
+// The chunks of a file without an ACL are stored in the ring under their content key, so identical
+// chunks are only stored once. The chunks of a file with an ACL are private to the file and carry
+// its ACL. Fragments are stored on the nodes listed in the manifest.
+type Manifest struct {
+	Size            int64      // Size is the size of the whole file in bytes
+	Checksum        string     // Checksum is the hex encoded SHA-256 of the whole file
+	ContentType     string     // ContentType is the MIME type of the whole file
+	ChunkSize       int64      // ChunkSize is the size of every chunk but the last
+	Chunks          []string   // Chunks are the checksums of the chunks in order
+	Private         bool       // Private is set if the chunks are stored under keys of the file, see chunkKey
+	DataFragments   int        // DataFragments is the number of data fragments of an erasure coded file (k)
+	ParityFragments int        // ParityFragments is the number of parity fragments of an erasure coded file (m)
+	Fragments       []Fragment // Fragments are the fragments of an erasure coded file in order
+}
+
+// Stores a file in the ring split into chunks of chunkSize bytes. The chunks are stored first, then a
+// manifest listing them is stored under the key of the file. The results are those of the manifest.
+func (node *Node) StoreChunked(path string, data []byte, chunkSize int64, opts StoreOptions) ([]ReplicaResult, error) {
+	if chunkSize < 1 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	err := ValidateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	opts.ACL, err = node.fileACL(path, opts.ACL)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Size:        int64(len(data)),
+		Checksum:    checksum(data),
+		ContentType: contentType(path, data),
+		ChunkSize:   chunkSize,
+		Private:     opts.ACL != nil,
+	}
+	var chunks [][]byte
+	for start := int64(0); start < int64(len(data)); start += chunkSize {
+		end := min(start+chunkSize, int64(len(data)))
+		chunks = append(chunks, data[start:end])
+		manifest.Chunks = append(manifest.Chunks, checksum(data[start:end]))
+	}
+
+	err = forEachChunk(len(chunks), func(i int) error {
+		return node.storeChunk(path, manifest.chunkKey(path, i), chunks[i], opts.parts())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store chunks: %w", err)
+	}
+
+	return node.storeManifest(path, manifest, opts)
+}
+
+// Stores a chunk of a file under its key, with the file among the references of the chunk. A chunk
+// that is already stored is only stored again to add the reference or extend its expiry. Chunks
+// stored without references may be shared with files that are not known, so they are never given
+// references and never released.
+func (node *Node) storeChunk(path string, key string, data []byte, opts StoreOptions) error {
+	info := node.newObjectInfo(key, data, opts)
+	info.Name = filepath.Base(path)
+	info.ContentType = contentType(path, data)
+	info.References = []string{path}
+	if previous, err := node.statObject(key); err == nil && !previous.Expired(time.Now()) && previous.Checksum == checksum(data) {
+		if len(previous.References) == 0 || slices.Contains(previous.References, path) {
+			if !expiresBefore(previous.Expires, opts.Expires) {
+				return nil
+			}
+			info.References = previous.References
+		} else {
+			info.References = append(slices.Clone(previous.References), path)
+		}
+		if !expiresBefore(previous.Expires, opts.Expires) {
+			info.Expires = previous.Expires
+		}
+	}
+	_, err := node.storeObject(info, data)
+	return err
+}
+
+// Releases the chunks of a deleted file: the file is removed from the references of every chunk, and
+// chunks that are no longer referenced are replaced with tombstones. Chunks with concurrent versions
+// are left in place, since the references of the other versions are not known.
+func (node *Node) releaseChunks(path string, manifest Manifest) error {
+	keys := make([]string, len(manifest.Chunks))
+	for i := range manifest.Chunks {
+		keys[i] = manifest.chunkKey(path, i)
+	}
+	slices.Sort(keys)
+	var errs []error
+	for _, key := range slices.Compact(keys) {
+		err := node.releaseChunk(path, key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("chunk %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (node *Node) releaseChunk(path string, key string) error {
+	data, info, err := node.getObject(key)
+	if err != nil {
+		return err
+	}
+	if info.Expired(time.Now()) || len(info.Siblings) > 0 || !slices.Contains(info.References, path) {
+		return nil
+	}
+	info.References = slices.DeleteFunc(slices.Clone(info.References), func(ref string) bool { return ref == path })
+	info.Modified = time.Now()
+	info.Uploader = node.Address
+	if len(info.References) == 0 {
+		info = info.deletedBy(node.Address)
+		data = nil
+	}
+	_, err = node.storeObject(info, data)
+	return err
+}
+
+// Fetches the chunks or fragments listed in a manifest in parallel and reassembles the file. The metadata
+// of the manifest is returned with the size, checksum and content type of the whole file.
+func (node *Node) assembleChunks(encoded []byte, info ObjectInfo) ([]byte, ObjectInfo, error) {
+	manifest, err := decodeManifest(encoded)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if len(manifest.Fragments) > 0 {
+		return node.assembleFragments(manifest, info)
+	}
+
+	chunks := make([][]byte, len(manifest.Chunks))
+	err = forEachChunk(len(chunks), func(i int) error {
+		data, _, err := node.getObject(manifest.chunkKey(info.Key, i))
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if checksum(data) != manifest.Chunks[i] {
+			return fmt.Errorf("chunk %d: %w", i, ErrChecksum)
+		}
+		chunks[i] = data
+		return nil
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to get chunks: %w", err)
+	}
+
+	data := make([]byte, 0, manifest.Size)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	if checksum(data) != manifest.Checksum {
+		return nil, ObjectInfo{}, fmt.Errorf("reassembled file: %w", ErrChecksum)
+	}
+	return data, manifest.apply(info), nil
+}
+
+// Returns the key chunk i of a file is stored under: its content key, or for a private chunk a key
+// of the file, so that the chunk is not shared with files that have another ACL.
+func (manifest Manifest) chunkKey(path string, i int) string {
+	if manifest.Private {
+		return fmt.Sprintf("%s#chunk-%s", path, manifest.Chunks[i])
+	}
+	return casPrefix + manifest.Chunks[i]
+}
+
+// Decodes a manifest.
+func decodeManifest(encoded []byte) (Manifest, error) {
+	var manifest Manifest
+	err := json.Unmarshal(encoded, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Returns the metadata of a manifest with the size, checksum and content type of the whole file.
+func (manifest Manifest) apply(info ObjectInfo) ObjectInfo {
+	info.Size = manifest.Size
+	info.Checksum = manifest.Checksum
+	info.ContentType = manifest.ContentType
+	return info
+}
+
+// Calls f for every chunk index with at most chunkParallelism calls at the same time, and returns
+// the first error.
+func forEachChunk(n int, f func(i int) error) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, chunkParallelism)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := f(i)
+			if err != nil {
+				once.Do(func() { firstErr = err })
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,32 @@
+package chord
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManifestChunkKey(t *testing.T) {
+	chunk := []byte("chunk")
+	shared := Manifest{Chunks: []string{checksum(chunk)}}
+	if got := shared.chunkKey("a.txt", 0); got != ContentKey(chunk) {
+		t.Fatalf("chunkKey() of a shared chunk = %q, want %q", got, ContentKey(chunk))
+	}
+
+	// Private chunks of files with the same contents must not share a key
+	private := Manifest{Chunks: []string{checksum(chunk)}, Private: true}
+	a, b := private.chunkKey("a.txt", 0), private.chunkKey("b.txt", 0)
+	if a == b || isContentKey(a) || !strings.HasPrefix(a, "a.txt#") {
+		t.Fatalf("chunkKey() of private chunks = %q and %q, want keys of their files", a, b)
+	}
+	if err := ValidateKey(a); err != nil {
+		t.Fatalf("chunkKey() of a private chunk is invalid: %v", err)
+	}
+}
+
+func TestPartsKeepACL(t *testing.T) {
+	acl := &ACL{Owner: "CN=owner", Readers: []string{"CN=reader"}}
+	parts := StoreOptions{ACL: acl, Encryption: &Encryption{Algorithm: "AES-256-GCM"}}.parts()
+	if parts.ACL != acl || parts.Encryption != nil {
+		t.Fatalf("parts() = %+v, want the ACL of the file without its encryption", parts)
+	}
+}
@@ -2,13 +2,17 @@ package chord
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
 type CLI struct {
 	Node *Node
+	Key  *EncryptionKey // Key encrypts files stored with store -encrypt and decrypts them on lookup, nil if not configured
 }
 
 // Reads from stdin and handles commands.
@@ -33,13 +37,26 @@ func (c *CLI) handleCommand(args string) {
 	if len(parts) > 1 {
 		param = parts[1]
 	}
+	params := parts[1:]
 	switch command {
 	case "lookup":
 		c.lookup(param)
 	case "store":
-		c.storeFile(param)
+		c.storeFile(params)
+	case "stat":
+		c.stat(param)
+	case "repair":
+		c.repair(param)
+	case "delete":
+		c.delete(param)
+	case "chmod":
+		c.chmod(params)
+	case "chown":
+		c.chown(params)
 	case "print":
 		c.printState()
+	case "list":
+		c.list()
 	case "exit":
 		c.exit()
 	case "clear":
@@ -65,23 +82,174 @@ func (c *CLI) lookup(key string) {
 	fmt.Fprintf(os.Stdout, c.findFile(key))
 }
 
-// Finds the successor with a given key and returns the file information.
+// Gets the file with a given key from the ring and returns the file information and contents.
+// Encrypted files are decrypted with the key of the client.
 func (c *CLI) findFile(key string) string {
-	reply := new(FindSuccessorReply)
-	args := new(FindSuccessorArgs)
-	args.Key = Hash(key).String()
+	data, info, err := c.Node.GetFile(key)
+	if err != nil {
+		return fmt.Sprintf("Failed to get file: %s\n", err)
+	}
+	if info.Encryption != nil {
+		data, err = c.Key.Decrypt(data, info.Encryption)
+		if err != nil {
+			return fmt.Sprintf("%sFailed to decrypt file: %s\n", formatInfo(info), err)
+		}
+	}
+	return fmt.Sprintf("%sContent:\n%s\n", formatInfo(info), data)
+}
+
+// Prints the metadata of the file with a given key.
+func (c *CLI) stat(key string) {
+	if key == "" {
+		fmt.Fprintf(os.Stderr, "No key supplied\n")
+		return
+	}
+	info, err := c.Node.StatFile(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to stat file: %s\n", err)
+		return
+	}
+	fmt.Fprint(os.Stdout, formatInfo(info))
+}
+
+// Regenerates the lost fragments of an erasure coded file.
+func (c *CLI) repair(key string) {
+	if key == "" {
+		fmt.Fprintf(os.Stderr, "No key supplied\n")
+		return
+	}
+	n, err := c.Node.RepairFile(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to repair file: %s\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "Regenerated %d fragments of %s\n", n, key)
+}
+
+// Deletes the file with a given key from the ring.
+func (c *CLI) delete(key string) {
+	if key == "" {
+		fmt.Fprintf(os.Stderr, "No key supplied\n")
+		return
+	}
+	results, err := c.Node.DeleteFile(key)
+	printResults(results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete file: %s\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "Deleted %s\n", key)
+}
+
+// Grants or revokes read or write access to a file, e.g. chmod +w CN=ci-runner builds/app.tar.
+// A principal of * stands for every node.
+func (c *CLI) chmod(args []string) {
+	if len(args) != 3 || len(args[0]) != 2 || !strings.Contains("+-", args[0][:1]) || !strings.Contains("rw", args[0][1:]) {
+		fmt.Fprintf(os.Stderr, "Usage: chmod [+r|-r|+w|-w] [principal] [key]\n")
+		return
+	}
+	c.updateACL(args[2], func(acl *ACL) {
+		principals := &acl.Readers
+		if args[0][1] == 'w' {
+			principals = &acl.Writers
+		}
+		*principals = slices.DeleteFunc(*principals, func(p string) bool { return p == args[1] })
+		if args[0][0] == '+' {
+			*principals = append(*principals, args[1])
+		}
+	})
+}
 
-	err := call("Node.FindSuccessor", c.Node.Address, args, reply)
+// Transfers the ownership of a file to another principal.
+func (c *CLI) chown(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: chown [principal] [key]\n")
+		return
+	}
+	c.updateACL(args[1], func(acl *ACL) { acl.Owner = args[0] })
+}
+
+// Changes the ACL of a file. A file without an ACL is claimed by this node first.
+func (c *CLI) updateACL(key string, update func(acl *ACL)) {
+	if Principal() == "" {
+		fmt.Fprintf(os.Stderr, "ACLs need a certificate signed by the cluster CA, start the node with -ca\n")
+		return
+	}
+	info, err := c.Node.StatFile(key)
 	if err != nil {
-		return "Failed to find successor\n"
+		fmt.Fprintf(os.Stderr, "Failed to stat file: %s\n", err)
+		return
+	}
+	acl := ACL{Owner: Principal()}
+	if info.ACL != nil {
+		acl = *info.ACL
+		acl.Readers = slices.Clone(acl.Readers)
+		acl.Writers = slices.Clone(acl.Writers)
 	}
+	update(&acl)
 
-	addr := reply.Successor.Address
-	data, err := TLSGet(reply.Successor, key)
+	results, err := c.Node.SetACL(key, acl)
+	printResults(results)
 	if err != nil {
-		return "Failed to get file\n"
+		fmt.Fprintf(os.Stderr, "Failed to change ACL: %s\n", err)
+		return
+	}
+	fmt.Fprint(os.Stdout, formatACL(&acl))
+}
+
+// Formats the ACL of a file.
+func formatACL(acl *ACL) string {
+	if acl == nil {
+		return "Access: any node\n"
+	}
+	return fmt.Sprintf("Owner: %s\nReaders: %s\nWriters: %s\n", acl.Owner, strings.Join(acl.Readers, ", "), strings.Join(acl.Writers, ", "))
+}
+
+// Prints the outcome of a write to every replica.
+func printResults(results []ReplicaResult) {
+	for _, result := range results {
+		switch {
+		case !result.Done:
+			fmt.Fprintf(os.Stdout, "  %s: pending\n", result.Replica.TLSAddress)
+		case result.Err != nil:
+			fmt.Fprintf(os.Stdout, "  %s: %s\n", result.Replica.TLSAddress, result.Err)
+		default:
+			fmt.Fprintf(os.Stdout, "  %s: ok\n", result.Replica.TLSAddress)
+		}
+	}
+}
+
+// Formats the metadata of a file.
+func formatInfo(info ObjectInfo) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Key: %s\n", info.Key))
+	b.WriteString(fmt.Sprintf("ID: %s\n", Hash(info.Key)))
+	b.WriteString(fmt.Sprintf("Name: %s\n", info.Name))
+	b.WriteString(fmt.Sprintf("Size: %d bytes\n", info.Size))
+	b.WriteString(fmt.Sprintf("SHA-256: %s\n", info.Checksum))
+	b.WriteString(fmt.Sprintf("Content type: %s\n", info.ContentType))
+	b.WriteString(fmt.Sprintf("Created: %s\n", info.Created.Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("Modified: %s\n", info.Modified.Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("Uploader: %s\n", info.Uploader))
+	b.WriteString(fmt.Sprintf("Version: %d %s\n", info.Version, info.Vector))
+	if info.Encryption != nil {
+		method := "key file"
+		if len(info.Encryption.Salt) > 0 {
+			method = "passphrase"
+		}
+		b.WriteString(fmt.Sprintf("Encrypted: %s with a %s, size and SHA-256 are of the encrypted contents\n", info.Encryption.Algorithm, method))
+	}
+	b.WriteString(formatACL(info.ACL))
+	if !info.Expires.IsZero() {
+		b.WriteString(fmt.Sprintf("Expires: %s\n", info.Expires.Format(time.RFC3339)))
 	}
-	return fmt.Sprintf("ID: %s\nAddress: %s\nContent:\n%s\n", Hash(addr), addr, data)
+	if len(info.Siblings) > 0 {
+		b.WriteString(fmt.Sprintf("Conflict: %d concurrent versions, the next store resolves it\n", len(info.Siblings)))
+		for _, sibling := range info.Siblings {
+			b.WriteString(fmt.Sprintf("  SHA-256: %s, %d bytes, by %s at %s %s\n", sibling.Checksum, sibling.Size, sibling.Uploader, sibling.Modified.Format(time.RFC3339), sibling.Vector))
+		}
+	}
+	return b.String()
 }
 
 // Useful test method for finding the successor of a given key
@@ -94,7 +262,7 @@ func (c *CLI) test(key string) {
 	args := new(FindSuccessorArgs)
 	args.Key = Hash(key).String()
 
-	err := call("Node.FindSuccessor", c.Node.Address, args, reply)
+	err := remote(c.Node.Address).FindSuccessor(args, reply)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to find successor\n")
 		return
@@ -104,7 +272,22 @@ func (c *CLI) test(key string) {
 
 // Takes the location of a file on a local disk, then performs a lookup.
 // Once the correct place of the file is found, the file gets uploaded to the Chord ring.
-func (c *CLI) storeFile(path string) {
+// With -chunk the file is split into chunks of the given size that are stored separately.
+// With -cas the file is stored under the hash of its contents instead of its path, and the key is printed.
+// With -ec k+m the file is erasure coded into k data and m parity fragments instead of being replicated.
+// With -ttl the file expires after the given time, e.g. 3d, and is deleted from every replica.
+// With -encrypt the contents are encrypted with the key of the client before they leave this node.
+func (c *CLI) storeFile(args []string) {
+	flags := flag.NewFlagSet("store", flag.ContinueOnError)
+	chunk := flags.String("chunk", "", "split the file into chunks of this size, e.g. 4M")
+	cas := flags.Bool("cas", false, "store the file under the hash of its contents")
+	ec := flags.String("ec", "", "erasure code the file into k data and m parity fragments, e.g. 4+2")
+	ttl := flags.String("ttl", "", "delete the file after this time, e.g. 90m, 72h or 3d")
+	encrypt := flags.Bool("encrypt", false, "encrypt the file with the key of the client")
+	if flags.Parse(args) != nil {
+		return
+	}
+	path := flags.Arg(0)
 	if path == "" {
 		fmt.Fprintf(os.Stderr, "No path supplied\n")
 		return
@@ -114,7 +297,65 @@ func (c *CLI) storeFile(path string) {
 		fmt.Fprintf(os.Stderr, "Failed to read file: %s\n", err)
 		return
 	}
-	c.Node.Store(path, data)
+
+	opts := StoreOptions{ACL: DefaultACL()}
+	if *ttl != "" {
+		duration, err := ParseTTL(*ttl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid ttl: %s\n", err)
+			return
+		}
+		opts.Expires = time.Now().Add(duration)
+	}
+	if *encrypt {
+		if c.Key == nil {
+			fmt.Fprintf(os.Stderr, "No encryption key, start the node with -keyfile or CHORD_PASSPHRASE set\n")
+			return
+		}
+		data, opts.Encryption, err = c.Key.Encrypt(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encrypt file: %s\n", err)
+			return
+		}
+	}
+
+	key := path
+	if *cas {
+		key = ContentKey(data)
+	}
+
+	var results []ReplicaResult
+	if *ec != "" {
+		var k, m int
+		_, err = fmt.Sscanf(*ec, "%d+%d", &k, &m)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid erasure coding %s, expected k+m\n", *ec)
+			return
+		}
+		results, err = c.Node.StoreErasure(key, data, k, m, opts)
+	} else if *cas && *chunk == "" {
+		key, results, err = c.Node.StoreContent(path, data, opts)
+		if err == nil && results == nil {
+			fmt.Fprintf(os.Stdout, "Already stored as %s\n", key)
+			return
+		}
+	} else if *chunk != "" {
+		var chunkSize int64
+		chunkSize, err = ParseSize(*chunk)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid chunk size: %s\n", err)
+			return
+		}
+		results, err = c.Node.StoreChunked(key, data, chunkSize, opts)
+	} else {
+		results, err = c.Node.Store(path, data, opts)
+	}
+	printResults(results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to store file: %s\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "Stored %s as %s\n", path, key)
 }
 
 // Outputs its local state information at the current time, which consists of:
@@ -126,13 +367,47 @@ func (c *CLI) printState() {
 	fmt.Fprintf(os.Stdout, "%s\n", c.Node.GetInfo())
 }
 
+// Lists the keys stored on this node together with their size, checksum and whether this node
+// is responsible for them.
+func (c *CLI) list() {
+	reply := new(ListKeysReply)
+	err := remote(c.Node.Address).ListKeys(&ListKeysArgs{}, reply)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list keys: %s\n", err)
+		return
+	}
+	for _, entry := range reply.Entries {
+		owned := " "
+		if c.Node.Owns(entry) {
+			owned = "*"
+		}
+		if entry.Deleted {
+			fmt.Fprintf(os.Stdout, "%s %s  expired %s\n", owned, entry.Key, entry.Expires.Format(time.RFC3339))
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s %s  %d bytes  sha256:%s\n", owned, entry.Key, entry.Size, entry.Checksum)
+	}
+	fmt.Fprintf(os.Stdout, "%d keys, digest %s\n", len(reply.Entries), c.Node.Index.Digest())
+}
+
 // Prints the usage message.
 func (c *CLI) usage() {
 	usage := `Usage: [command]
 Commands:
-  lookup [key] - lookup a file with the given key
-  store [path] - store a file with the given path
+  lookup [key] - lookup a file with the given key, decrypting it if it is encrypted
+  store [-chunk size] [-cas] [-ec k+m] [-ttl duration] [-encrypt] [path]
+               - store a file with the given path, optionally split into chunks,
+                 under the hash of its contents or erasure coded into fragments,
+                 deleted after the given time and encrypted with the client's key
+  repair [key] - regenerate the lost fragments of an erasure coded file
+  delete [key] - delete the file with the given key
+  chmod [+r|-r|+w|-w] [principal] [key]
+               - grant or revoke read or write access to a file, * for any node
+  chown [principal] [key]
+               - transfer the ownership of a file
+  stat [key]   - print the metadata of the file with the given key
   print        - print the state of the client
+  list         - list the keys stored on this node, * marks keys this node is responsible for
   exit         - exit the client
   help         - print this message
 `
@@ -0,0 +1,201 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrIdentity is returned when a node is not the node it claims to be.
+var ErrIdentity = errors.New("node identity mismatch")
+
+const nodeURIScheme = "chord" // Scheme of the URI that binds a certificate to a node address, e.g. chord://10.0.0.1:8080
+
+// The certificate and key the node presents on TLS connections, and the cluster CA if the ring
+// runs in cluster CA mode.
+var (
+	certFile  = "cert.pem"
+	keyFile   = "key.pem"
+	clusterCA *x509.CertPool // clusterCA is nil unless the ring runs in cluster CA mode
+)
+
+// Enables cluster CA mode, where the certificate of every node is signed by one of the CA
+// certificates in caFile. Nodes then require and verify the certificate of the nodes connecting to
+// them, and verify the certificate of a node they connect to against the CA and the node's address
+// instead of trusting the public key the node advertised.
+func UseClusterCA(caFile string) error {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return errors.New("no CA certificates found in " + caFile)
+	}
+	clusterCA = pool
+	return nil
+}
+
+// Returns the TLS configuration the node listens for connections with. Every connection is served
+// with the current certificate of the node.
+func serverTLSConfig() *tls.Config {
+	config := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certificates.certificate()
+		},
+		NextProtos: []string{"h2"}, // Every TLS connection carries the gRPC Node service
+	}
+	if clusterCA != nil {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = clusterCA
+		config.MinVersion = tls.VersionTLS12
+	}
+	return config
+}
+
+// Returns the TLS configuration for connecting to a node. In cluster CA mode the node's certificate
+// must be signed by the CA and issued for the node's address. Otherwise the certificate
+// the node advertised in its NodeRef is trusted.
+func clientTLSConfig(nodeRef NodeRef) (*tls.Config, error) {
+	config := &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certificates.certificate()
+		},
+	}
+	if clusterCA == nil {
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(nodeRef.PublicKey)
+		config.RootCAs = caCertPool
+		return config, nil
+	}
+
+	config.RootCAs = clusterCA
+	config.MinVersion = tls.VersionTLS12
+	if nodeRef.Address != "" {
+		host, _, err := net.SplitHostPort(nodeRef.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node address %s: %w", nodeRef.Address, err)
+		}
+		config.ServerName = host
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyIdentity(state.PeerCertificates[0], nodeRef.Address)
+		}
+	}
+	return config, nil
+}
+
+// Checks that the certificate a node connected with belongs to the node it claims to be. The
+// certificate must be issued for the claimed address and be the certificate the node advertises.
+func verifyPeer(cert *x509.Certificate, claimed NodeRef) error {
+	err := verifyIdentity(cert, claimed.Address)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(claimed.PublicKey)
+	if block == nil || !bytes.Equal(block.Bytes, cert.Raw) {
+		return fmt.Errorf("%w: advertised public key is not the presented certificate", ErrIdentity)
+	}
+	return nil
+}
+
+// Checks that the certificate a NodeRef advertises is signed by the cluster CA and issued for the
+// address of the node. The ID of a node is the hash of its address, so a node can only take the
+// place in the ring the CA issued it a certificate for. Without a cluster CA every NodeRef is accepted.
+func verifyNodeRef(ref NodeRef) error {
+	if clusterCA == nil {
+		return nil
+	}
+	block, _ := pem.Decode(ref.PublicKey)
+	if block == nil {
+		return fmt.Errorf("%w: %s advertises no certificate", ErrIdentity, ref.Address)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: %s advertises an invalid certificate: %v", ErrIdentity, ref.Address, err)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{Roots: clusterCA, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err != nil {
+		return fmt.Errorf("%w: certificate of %s: %v", ErrIdentity, ref.Address, err)
+	}
+	return verifyIdentity(cert, ref.Address)
+}
+
+// Returns the NodeRefs that pass verifyNodeRef, logging the others.
+func verifiedNodeRefs(refs []NodeRef) []NodeRef {
+	var verified []NodeRef
+	for _, ref := range refs {
+		err := verifyNodeRef(ref)
+		if err != nil {
+			log.Printf("Ignoring node %s: %v\n", ref.Address, err)
+			continue
+		}
+		verified = append(verified, ref)
+	}
+	return verified
+}
+
+// Checks that a certificate is issued for a node address, i.e. that it has a chord://address URI
+// in its subject alternative names.
+func verifyIdentity(cert *x509.Certificate, address string) error {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == nodeURIScheme && uri.Host == address {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: certificate is not issued for %s", ErrIdentity, address)
+}
+
+// Reports whether a certificate is issued for a node rather than a client, i.e. whether it has a
+// chord:// URI in its subject alternative names.
+func isNodeCertificate(cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == nodeURIScheme {
+			return true
+		}
+	}
+	return false
+}
+
+// connCredentials are the credentials of the gRPC server of a node. Its listeners hand it TLS
+// connections, whose handshake it runs, and in legacy mode plaintext connections, which carry no
+// identity. Methods that need TLS check the AuthInfo of the call, see requireTLS.
+type connCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c connCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		if clusterCA != nil {
+			return nil, nil, errors.New("plaintext connection in cluster CA mode")
+		}
+		return conn, insecureInfo{credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}, nil
+	}
+	err := tlsConn.Handshake()
+	if err != nil {
+		return nil, nil, err
+	}
+	info := credentials.TLSInfo{
+		State:          tlsConn.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}
+	return conn, info, nil
+}
+
+// insecureInfo is the AuthInfo of a plaintext connection.
+type insecureInfo struct {
+	credentials.CommonAuthInfo
+}
+
+func (insecureInfo) AuthType() string { return "insecure" }
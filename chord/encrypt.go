@@ -0,0 +1,144 @@
+package chord
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	encryptionAlgorithm = "AES-256-GCM"
+	encryptionKeySize   = 32     // Size of an AES-256 key in bytes
+	passphraseSaltSize  = 16     // Size of the random salt a key is derived from a passphrase with
+	passphraseRounds    = 600000 // Number of PBKDF2-HMAC-SHA256 iterations to derive a key from a passphrase
+)
+
+// ErrNoKey is returned when an encrypted file is read without the key it was encrypted with.
+var ErrNoKey = errors.New("no encryption key")
+
+// Encryption describes how the contents of a file were encrypted before they were stored. The
+// checksum and size of the file are those of the encrypted contents.
+type Encryption struct {
+	Algorithm string // Algorithm is the cipher the contents were encrypted with
+	Nonce     []byte // Nonce is the nonce the contents were encrypted with
+	Salt      []byte // Salt is the salt the key was derived from the passphrase with, empty for a key file
+}
+
+// EncryptionKey is the key a client encrypts files with before storing them, either read from a key
+// file or derived from a passphrase for every file. Nodes only ever see the encrypted contents.
+type EncryptionKey struct {
+	key        []byte
+	passphrase []byte
+}
+
+// Reads a key file holding a 256-bit key, as 32 raw bytes or 64 hex digits.
+func LoadKeyFile(path string) (*EncryptionKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == encryptionKeySize {
+		return &EncryptionKey{key: data}, nil
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("%s should hold a %d byte key, raw or hex encoded", path, encryptionKeySize)
+	}
+	return &EncryptionKey{key: key}, nil
+}
+
+// Returns a key that derives a key for every file from a passphrase and a random salt.
+func PassphraseKey(passphrase string) *EncryptionKey {
+	return &EncryptionKey{passphrase: []byte(passphrase)}
+}
+
+// Encrypts data with a fresh nonce and returns the encrypted data and how it was encrypted.
+func (k *EncryptionKey) Encrypt(data []byte) ([]byte, *Encryption, error) {
+	encryption := &Encryption{Algorithm: encryptionAlgorithm}
+	if k.passphrase != nil {
+		encryption.Salt = make([]byte, passphraseSaltSize)
+		_, err := rand.Read(encryption.Salt)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	aead, err := k.aead(encryption)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryption.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(encryption.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead.Seal(nil, encryption.Nonce, data, nil), encryption, nil
+}
+
+// Decrypts data that was encrypted as described. Fails if the key is not the one the data was
+// encrypted with or if the data was modified.
+func (k *EncryptionKey) Decrypt(data []byte, encryption *Encryption) ([]byte, error) {
+	if k == nil {
+		return nil, ErrNoKey
+	}
+	if encryption.Algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption %s", encryption.Algorithm)
+	}
+	aead, err := k.aead(encryption)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, encryption.Nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt, wrong key or modified contents: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Returns the cipher for a file, deriving its key from the passphrase if the file has a salt.
+func (k *EncryptionKey) aead(encryption *Encryption) (cipher.AEAD, error) {
+	key := k.key
+	if len(encryption.Salt) > 0 {
+		if k.passphrase == nil {
+			return nil, errors.New("file is encrypted with a passphrase, not a key file")
+		}
+		key = pbkdf2(k.passphrase, encryption.Salt, passphraseRounds, encryptionKeySize)
+	} else if key == nil {
+		return nil, errors.New("file is encrypted with a key file, not a passphrase")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Derives a key of the given length from a passphrase with PBKDF2-HMAC-SHA256 (RFC 8018).
+func pbkdf2(passphrase []byte, salt []byte, rounds int, length int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < rounds; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
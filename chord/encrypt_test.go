@@ -0,0 +1,142 @@
+package chord
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a key file with the given contents and loads it.
+func loadTestKey(t *testing.T, contents []byte) *EncryptionKey {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chord.key")
+	err := os.WriteFile(path, contents, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeyFile() error = %v", err)
+	}
+	return key
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, encryptionKeySize)
+	if key := loadTestKey(t, raw); !bytes.Equal(key.key, raw) {
+		t.Fatalf("LoadKeyFile() of a raw key = %x, want %x", key.key, raw)
+	}
+	if key := loadTestKey(t, []byte(hex.EncodeToString(raw)+"\n")); !bytes.Equal(key.key, raw) {
+		t.Fatalf("LoadKeyFile() of a hex key = %x, want %x", key.key, raw)
+	}
+
+	path := filepath.Join(t.TempDir(), "short.key")
+	err := os.WriteFile(path, []byte("abcd"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeyFile(path)
+	if err == nil {
+		t.Fatal("LoadKeyFile() of a short key succeeded")
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	data := []byte("the contents of a file")
+	keyFile := loadTestKey(t, bytes.Repeat([]byte{1}, encryptionKeySize))
+	otherKeyFile := loadTestKey(t, bytes.Repeat([]byte{2}, encryptionKeySize))
+	passphrase := PassphraseKey("correct horse battery staple")
+
+	tests := []struct {
+		name     string
+		key      *EncryptionKey
+		wrongKey *EncryptionKey
+	}{
+		{"key file", keyFile, otherKeyFile},
+		{"passphrase", passphrase, PassphraseKey("wrong horse battery staple")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encrypted, encryption, err := test.key.Encrypt(data)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if bytes.Contains(encrypted, data) || encryption.Algorithm != encryptionAlgorithm {
+				t.Fatalf("Encrypt() = %q, %+v, want the contents encrypted with %s", encrypted, encryption, encryptionAlgorithm)
+			}
+			if (test.key.passphrase != nil) != (len(encryption.Salt) == passphraseSaltSize) {
+				t.Fatalf("Encrypt() salt = %x, want a salt only for a passphrase", encryption.Salt)
+			}
+			decrypted, err := test.key.Decrypt(encrypted, encryption)
+			if err != nil || !bytes.Equal(decrypted, data) {
+				t.Fatalf("Decrypt() = %q, %v, want %q", decrypted, err, data)
+			}
+
+			_, err = test.wrongKey.Decrypt(encrypted, encryption)
+			if err == nil {
+				t.Fatal("Decrypt() with the wrong key succeeded")
+			}
+			tampered := bytes.Clone(encrypted)
+			tampered[0] ^= 1
+			_, err = test.key.Decrypt(tampered, encryption)
+			if err == nil {
+				t.Fatal("Decrypt() of tampered contents succeeded")
+			}
+		})
+	}
+
+	// Every file is encrypted with a fresh nonce
+	first, firstEncryption, _ := keyFile.Encrypt(data)
+	second, secondEncryption, _ := keyFile.Encrypt(data)
+	if bytes.Equal(first, second) || bytes.Equal(firstEncryption.Nonce, secondEncryption.Nonce) {
+		t.Fatal("Encrypt() of the same contents twice returned the same nonce and contents")
+	}
+}
+
+func TestDecryptRejectsOtherKinds(t *testing.T) {
+	keyFile := loadTestKey(t, bytes.Repeat([]byte{1}, encryptionKeySize))
+	encrypted, encryption, err := keyFile.Encrypt([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var noKey *EncryptionKey
+	_, err = noKey.Decrypt(encrypted, encryption)
+	if !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Decrypt() without a key error = %v, want %v", err, ErrNoKey)
+	}
+	_, err = PassphraseKey("passphrase").Decrypt(encrypted, encryption)
+	if err == nil || !strings.Contains(err.Error(), "key file") {
+		t.Fatalf("Decrypt() of a key file encrypted file with a passphrase error = %v", err)
+	}
+	_, err = keyFile.Decrypt(encrypted, &Encryption{Algorithm: "ROT13", Nonce: encryption.Nonce})
+	if err == nil {
+		t.Fatal("Decrypt() with an unsupported algorithm succeeded")
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 test vectors of RFC 7914, section 11. RFC 6070 only has vectors for SHA-1.
+	tests := []struct {
+		passphrase, salt string
+		rounds           int
+		want             string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(test.passphrase), []byte(test.salt), test.rounds, 64))
+		if got != test.want {
+			t.Fatalf("pbkdf2(%q, %q, %d) = %s, want %s", test.passphrase, test.salt, test.rounds, got, test.want)
+		}
+	}
+	// A shorter key is a prefix of the longer one
+	if got := hex.EncodeToString(pbkdf2([]byte("passwd"), []byte("salt"), 1, 20)); got != tests[0].want[:40] {
+		t.Fatalf("pbkdf2() of 20 bytes = %s, want %s", got, tests[0].want[:40])
+	}
+}
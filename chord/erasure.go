@@ -0,0 +1,281 @@
+package chord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Fragment is an erasure coded fragment of a file, stored on a specific node.
+type Fragment struct {
+	Checksum string  // Checksum is the hex encoded SHA-256 of the fragment
+	Node     NodeRef // Node is the node the fragment is stored on
+}
+
+// Returns the key the i-th fragment of a file is stored under.
+func fragmentKey(key string, i int) string {
+	return fmt.Sprintf("%s#fragment-%d", key, i)
+}
+
+// Stores a file in the ring as k data fragments and m parity fragments, placed on distinct successive
+// nodes starting at the successor of the key. Any k of the fragments are enough to get the file back.
+// A manifest listing the fragments and their nodes is stored under the key of the file and replicated
+// like any other file. The results are those of the manifest.
+func (node *Node) StoreErasure(path string, data []byte, k int, m int, opts StoreOptions) ([]ReplicaResult, error) {
+	err := ValidateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := newReedSolomon(k, m)
+	if err != nil {
+		return nil, err
+	}
+	opts.ACL, err = node.fileACL(path, opts.ACL)
+	if err != nil {
+		return nil, err
+	}
+	fragments := rs.Encode(data)
+	nodes, err := node.fragmentNodes(path, len(fragments))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{
+		Size:            int64(len(data)),
+		Checksum:        checksum(data),
+		ContentType:     contentType(path, data),
+		DataFragments:   k,
+		ParityFragments: m,
+		Fragments:       make([]Fragment, len(fragments)),
+	}
+	err = forEachChunk(len(fragments), func(i int) error {
+		manifest.Fragments[i] = Fragment{Checksum: checksum(fragments[i]), Node: nodes[i]}
+		return node.sendFragment(path, i, fragments[i], nodes[i], opts.parts())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store fragments: %w", err)
+	}
+	return node.storeManifest(path, manifest, opts)
+}
+
+// Regenerates the lost fragments of an erasure coded file from the remaining ones and places them on
+// nodes. Returns the number of fragments that were regenerated.
+func (node *Node) RepairFile(path string) (int, error) {
+	encoded, info, err := node.getObject(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.Expired(time.Now()) {
+		return 0, ErrNotFound
+	}
+	if !info.Manifest {
+		return 0, fmt.Errorf("%s is not erasure coded", path)
+	}
+	manifest, err := decodeManifest(encoded)
+	if err != nil {
+		return 0, err
+	}
+	if len(manifest.Fragments) == 0 {
+		return 0, fmt.Errorf("%s is not erasure coded", path)
+	}
+
+	fragments, missing, err := node.fetchFragments(path, manifest)
+	if err != nil {
+		return 0, err
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+	return len(missing), node.repairFragments(path, manifest, fragments, missing, info.storeOptions())
+}
+
+// Fetches the fragments listed in a manifest and reconstructs the file. Lost fragments are
+// regenerated in the background.
+func (node *Node) assembleFragments(manifest Manifest, info ObjectInfo) ([]byte, ObjectInfo, error) {
+	fragments, missing, err := node.fetchFragments(info.Key, manifest)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if len(missing) > 0 {
+		go func() {
+			err := node.repairFragments(info.Key, manifest, fragments, missing, info.storeOptions())
+			if err != nil {
+				log.Printf("Failed to repair fragments of %s: %v\n", info.Key, err)
+			}
+		}()
+	}
+
+	rs, err := newReedSolomon(manifest.DataFragments, manifest.ParityFragments)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	data, err := rs.Join(fragments, manifest.Size)
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("invalid fragments of %s: %w", info.Key, err)
+	}
+	if checksum(data) != manifest.Checksum {
+		return nil, ObjectInfo{}, fmt.Errorf("reconstructed file: %w", ErrChecksum)
+	}
+	return data, manifest.apply(info), nil
+}
+
+// Fetches the fragments of a file in parallel and reconstructs the ones that are lost or corrupt.
+// Returns all fragments and the indices of the ones that had to be reconstructed.
+func (node *Node) fetchFragments(key string, manifest Manifest) ([][]byte, []int, error) {
+	rs, err := newReedSolomon(manifest.DataFragments, manifest.ParityFragments)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(manifest.Fragments) != manifest.DataFragments+manifest.ParityFragments {
+		return nil, nil, fmt.Errorf("manifest of %s lists %d fragments for %d+%d erasure coding", key, len(manifest.Fragments), manifest.DataFragments, manifest.ParityFragments)
+	}
+
+	fragments := make([][]byte, len(manifest.Fragments))
+	forEachChunk(len(fragments), func(i int) error {
+		fragment := manifest.Fragments[i]
+		data, _, err := TLSGet(fragment.Node, fragmentKey(key, i), node.MaxRequestSize)
+		if err == nil && checksum(data) != fragment.Checksum {
+			err = ErrChecksum
+		}
+		if err != nil {
+			log.Printf("Fragment %d of %s on %s: %v\n", i, key, fragment.Node.TLSAddress, err)
+			return nil
+		}
+		fragments[i] = data
+		return nil
+	})
+
+	var missing []int
+	for i, fragment := range fragments {
+		if fragment == nil {
+			missing = append(missing, i)
+		}
+	}
+	err = rs.Reconstruct(fragments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%d of %d fragments of %s lost: %w", len(missing), len(fragments), key, err)
+	}
+	return fragments, missing, nil
+}
+
+// Places the regenerated fragments on nodes, preferring nodes that do not hold another fragment of
+// the file, and stores the manifest with the new placement. The options are those the file was stored with.
+func (node *Node) repairFragments(key string, manifest Manifest, fragments [][]byte, missing []int, opts StoreOptions) error {
+	nodes, err := node.fragmentNodes(key, len(fragments))
+	if err != nil {
+		return err
+	}
+	lost := make(map[int]bool)
+	for _, i := range missing {
+		lost[i] = true
+	}
+	holding := make(map[string]bool)
+	for i, fragment := range manifest.Fragments {
+		if !lost[i] {
+			holding[fragment.Node.TLSAddress] = true
+		}
+	}
+
+	for _, i := range missing {
+		target := nodes[i]
+		for _, candidate := range nodes {
+			if !holding[candidate.TLSAddress] {
+				target = candidate
+				break
+			}
+		}
+		log.Printf("Regenerating fragment %d of %s on %s\n", i, key, target.TLSAddress)
+		err := node.sendFragment(key, i, fragments[i], target, opts.parts())
+		if err != nil {
+			return err
+		}
+		holding[target.TLSAddress] = true
+		manifest.Fragments[i].Node = target
+	}
+	_, err = node.storeManifest(key, manifest, opts)
+	return err
+}
+
+// Sends a fragment to the node it is placed on, as the next version of the fragment on that node.
+func (node *Node) sendFragment(key string, i int, data []byte, nodeRef NodeRef, opts StoreOptions) error {
+	info := node.newObjectInfo(fragmentKey(key, i), data, opts)
+	info.Fragment = true
+	info.Vector = VersionVector{}.Increment(node.Address)
+	previous, err := TLSStat(nodeRef, info.Key)
+	if err == nil {
+		info.Created = previous.Created
+		info.Vector = previous.CausalVector().Increment(node.Address)
+	} else if !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("fragment %d on %s: %w", i, nodeRef.TLSAddress, err)
+	}
+	err = TLSSend(nodeRef, info, data)
+	if err != nil {
+		return fmt.Errorf("fragment %d on %s: %w", i, nodeRef.TLSAddress, err)
+	}
+	return nil
+}
+
+// Replaces the fragments of a deleted file with tombstones on the nodes they are placed on.
+func (node *Node) deleteFragments(key string, manifest Manifest) error {
+	var errs []error
+	for i, fragment := range manifest.Fragments {
+		err := TLSDelete(fragment.Node, fragmentKey(key, i), node.Address)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("fragment %d on %s: %w", i, fragment.Node.TLSAddress, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Returns n nodes for the fragments of a key: the successor of the key followed by its successors.
+// If the ring has fewer than n nodes, nodes are reused.
+func (node *Node) fragmentNodes(key string, n int) ([]NodeRef, error) {
+	succArgs := new(FindSuccessorArgs)
+	succArgs.Key = Hash(key).String()
+	succReply := new(FindSuccessorReply)
+	err := remote(node.Address).FindSuccessor(succArgs, succReply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find successor: %w", err)
+	}
+
+	candidates := []NodeRef{succReply.Successor}
+	listReply := new(GetSuccessorlistReply)
+	if remote(succReply.Successor.Address).GetSuccessorList(&GetSuccessorlistArgs{}, listReply) == nil {
+		candidates = append(candidates, listReply.Successors...)
+	}
+
+	var distinct []NodeRef
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if candidate.TLSAddress != "" && !seen[candidate.TLSAddress] {
+			seen[candidate.TLSAddress] = true
+			distinct = append(distinct, candidate)
+		}
+	}
+	if len(distinct) == 0 {
+		return nil, fmt.Errorf("no node to place the fragments of %s on", key)
+	}
+	if len(distinct) < n {
+		log.Printf("Only %d distinct nodes for %d fragments of %s\n", len(distinct), n, key)
+	}
+
+	nodes := make([]NodeRef, n)
+	for i := range nodes {
+		nodes[i] = distinct[i%len(distinct)]
+	}
+	return nodes, nil
+}
+
+// Stores the manifest of a file under the key of the file.
+func (node *Node) storeManifest(key string, manifest Manifest, opts StoreOptions) ([]ReplicaResult, error) {
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	info := node.newObjectInfo(key, encoded, opts)
+	info.ContentType = manifestMediaType
+	info.Manifest = true
+	return node.storeObject(info, encoded)
+}
@@ -0,0 +1,84 @@
+package chord
+
+import (
+	"bytes"
+	"log"
+	"time"
+)
+
+const (
+	expiredWriter      = "expired"      // Writer of tombstones in version vectors, the same on every replica
+	tombstoneRetention = 24 * time.Hour // How long tombstones are kept after expiry before they are removed
+)
+
+// Checks if an object has expired, or is the tombstone of an expired object.
+func (info ObjectInfo) Expired(now time.Time) bool {
+	return info.Deleted || (!info.Expires.IsZero() && !now.Before(info.Expires))
+}
+
+// Returns the tombstone that replaces an expired object. Every replica derives the same tombstone
+// from the same version, so replicas that sweep independently agree, and a stale copy of the object
+// that is replicated later is dropped as older than the tombstone.
+func (info ObjectInfo) tombstone() ObjectInfo {
+	info.Deleted = true
+	info.Modified = info.Expires
+	info.Version++
+	info.Vector = info.CausalVector().Increment(expiredWriter)
+	info.Siblings = nil
+	return info
+}
+
+// Checks if an object that expires at a given time expires before another time, zero meaning never.
+func expiresBefore(expires time.Time, other time.Time) bool {
+	return !expires.IsZero() && (other.IsZero() || expires.Before(other))
+}
+
+// Replaces the expired objects stored on this node with tombstones, and removes tombstones once they
+// have been kept for tombstoneRetention, by which time every replica has swept the object.
+func (node *Node) SweepExpired() {
+	now := time.Now()
+	for _, entry := range node.Index.List() {
+		switch {
+		case entry.Deleted && now.After(entry.Expires.Add(tombstoneRetention)):
+			node.removeTombstone(entry.Key)
+		case !entry.Deleted && entry.Expired(now):
+			node.expire(entry.Key)
+		}
+	}
+}
+
+// Replaces an expired object with its tombstone.
+func (node *Node) expire(key string) {
+	node.writeLock.Lock()
+	defer node.writeLock.Unlock()
+
+	// The object may have been replaced since the index was listed
+	stored, err := node.Storage.Stat(key)
+	if err != nil || stored.Deleted || !stored.Expired(time.Now()) {
+		return
+	}
+	info, err := node.Storage.Put(stored.tombstone(), bytes.NewReader(nil))
+	if err != nil {
+		log.Printf("Failed to expire %s: %v\n", key, err)
+		return
+	}
+	node.Index.Put(info)
+	log.Printf("Expired %s %s\n", key, info.Vector)
+}
+
+// Removes the tombstone of an expired object.
+func (node *Node) removeTombstone(key string) {
+	node.writeLock.Lock()
+	defer node.writeLock.Unlock()
+
+	stored, err := node.Storage.Stat(key)
+	if err != nil || !stored.Deleted {
+		return
+	}
+	err = node.Storage.Delete(key)
+	if err != nil {
+		log.Printf("Failed to remove tombstone of %s: %v\n", key, err)
+		return
+	}
+	node.Index.Remove(key)
+}
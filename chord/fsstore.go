@@ -0,0 +1,251 @@
+package chord
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const metaSuffix = ".meta" // Suffix of the sidecar file holding the metadata of an object
+
+// FSStore is a Store that keeps every object as a file in a directory. Files are named after the
+// hex encoded hash of their key, so any key maps to a safe file name, and the metadata of the object,
+// including the original key and the checksum of the contents, is kept in a sidecar next to the file.
+//
+// Objects and sidecars are written to a temporary file, synced and then renamed into place, so a
+// crash never leaves a partially written object behind. Reads are verified against the checksum.
+type FSStore struct {
+	Root string // Root is the directory the objects are stored in
+}
+
+func NewFSStore(root string) *FSStore {
+	return &FSStore{Root: root}
+}
+
+func (s *FSStore) Put(info ObjectInfo, r io.Reader) (ObjectInfo, error) {
+	err := ValidateKey(info.Key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	h := sha256.New()
+	var size int64
+	err = writeAtomic(s.path(info.Key), func(file *os.File) error {
+		var err error
+		size, err = io.Copy(file, io.TeeReader(r, h))
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info.Size = size
+	info.Checksum = hex.EncodeToString(h.Sum(nil))
+	meta, err := json.Marshal(info)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	err = writeAtomic(s.path(info.Key)+metaSuffix, func(file *os.File) error {
+		_, err := file.Write(meta)
+		return err
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return info, nil
+}
+
+// Opens the object stored under key. Reading the object to the end returns ErrChecksum if the
+// contents do not match the checksum they were stored with.
+func (s *FSStore) Get(key string) (io.ReadCloser, error) {
+	info, err := s.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{NewChecksumReader(file, info.Checksum), file}, nil
+}
+
+func (s *FSStore) Delete(key string) error {
+	err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(s.path(key) + metaSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.path(key))
+}
+
+func (s *FSStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), metaSuffix) {
+			continue
+		}
+		meta, err := s.readMeta(filepath.Join(s.Root, entry.Name()))
+		if err != nil {
+			// One damaged sidecar must not hide the other objects
+			log.Printf("Skipped unreadable metadata %s: %s\n", entry.Name(), err)
+			continue
+		}
+		keys = append(keys, meta.Key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *FSStore) Stat(key string) (ObjectInfo, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := s.readMeta(s.path(key) + metaSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return info, err
+}
+
+// Moves the files of stores written before objects were named after the hash of their key into
+// place. Such files are named after their key, with subdirectories for the segments of the key, and
+// have no sidecar. Each one is stored again under its hashed name with a sidecar and then removed,
+// along with the directories left empty. Returns the number of files migrated.
+func (s *FSStore) Migrate() (int, error) {
+	var legacy, dirs []string
+	err := filepath.WalkDir(s.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == s.Root {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if filepath.Dir(path) == s.Root && s.isObjectFile(d.Name()) {
+			return nil
+		}
+		legacy = append(legacy, path)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, path := range legacy {
+		err = s.migrateFile(path)
+		if err != nil {
+			return i, err
+		}
+	}
+	// Directories are removed deepest first, those that are not empty are kept
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return len(legacy), nil
+}
+
+// Stores a file of the legacy layout under its hashed name and removes it.
+func (s *FSStore) migrateFile(path string) error {
+	rel, err := filepath.Rel(s.Root, path)
+	if err != nil {
+		return err
+	}
+	key := filepath.ToSlash(rel)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	info := ObjectInfo{Key: key, Name: filepath.Base(path), Created: stat.ModTime(), Modified: stat.ModTime()}
+	_, err = s.Put(info, file)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", key, err)
+	}
+	return os.Remove(path)
+}
+
+// Reports whether a file in the root belongs to the hashed layout: an object, a sidecar or a
+// temporary file. Objects whose sidecar was never written are left alone rather than migrated.
+func (s *FSStore) isObjectFile(name string) bool {
+	if strings.HasPrefix(name, ".tmp-") {
+		return true
+	}
+	hash := strings.TrimSuffix(name, metaSuffix)
+	return len(hash) == 2*sha1.Size && strings.Trim(hash, "0123456789abcdef") == ""
+}
+
+// Reads a metadata sidecar.
+func (s *FSStore) readMeta(path string) (ObjectInfo, error) {
+	var meta ObjectInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return meta, fmt.Errorf("invalid metadata in %s: %w", filepath.Base(path), err)
+	}
+	return meta, nil
+}
+
+// Writes a file by writing to a temporary file in the same directory, syncing it and renaming it
+// into place, so that the file is either fully written or not changed at all.
+func writeAtomic(path string, write func(file *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Returns the path of the file an object is stored in, named after the hex encoded hash of the key.
+func (s *FSStore) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(s.Root, hex.EncodeToString(sum[:]))
+}
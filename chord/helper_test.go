@@ -0,0 +1,38 @@
+package chord
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  int64
+		valid bool
+	}{
+		{"512", 512, true},
+		{"64K", 64 << 10, true},
+		{"4m", 4 << 20, true},
+		{"2G", 2 << 30, true},
+		{strconv.FormatInt(math.MaxInt64, 10), math.MaxInt64, true},
+		{strconv.FormatInt(math.MaxInt64>>30, 10) + "G", math.MaxInt64 >> 30 << 30, true},
+		{strconv.FormatInt(math.MaxInt64>>30+1, 10) + "G", 0, false},
+		{"9223372036854775807K", 0, false},
+		{"9223372036854775808", 0, false},
+		{"", 0, false},
+		{"G", 0, false},
+		{"-1", 0, false},
+		{"12T", 0, false},
+	}
+	for _, test := range tests {
+		got, err := ParseSize(test.s)
+		if test.valid && (err != nil || got != test.want) {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", test.s, got, err, test.want)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", test.s, got)
+		}
+	}
+}
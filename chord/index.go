@@ -0,0 +1,85 @@
+package chord
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+)
+
+// KeyIndex is an in-memory index of the keys stored on this node.
+type KeyIndex struct {
+	mu      sync.RWMutex
+	entries map[string]ObjectInfo
+}
+
+func NewKeyIndex() *KeyIndex {
+	return &KeyIndex{entries: make(map[string]ObjectInfo)}
+}
+
+// Adds or replaces an entry in the index.
+func (idx *KeyIndex) Put(entry ObjectInfo) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.entries[entry.Key] = entry
+}
+
+// Removes a key from the index.
+func (idx *KeyIndex) Remove(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.entries, key)
+}
+
+// Gets the entry for a key.
+func (idx *KeyIndex) Get(key string) (ObjectInfo, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	entry, ok := idx.entries[key]
+	return entry, ok
+}
+
+// Lists all entries sorted by key.
+func (idx *KeyIndex) List() []ObjectInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	entries := make([]ObjectInfo, 0, len(idx.entries))
+	for _, entry := range idx.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Returns a digest over all keys and checksums in the index. Two nodes holding the same
+// replicas have the same digest, so replicas can be compared without listing every key.
+func (idx *KeyIndex) Digest() string {
+	h := sha256.New()
+	for _, entry := range idx.List() {
+		h.Write([]byte(entry.Key))
+		h.Write([]byte{0})
+		h.Write([]byte(entry.Checksum))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Scans the storage and builds the index of the keys already stored on this node. Keys whose
+// metadata cannot be read are logged and left out of the index.
+func (node *Node) BuildIndex() error {
+	node.Index = NewKeyIndex()
+	keys, err := node.Storage.List()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		info, err := node.Storage.Stat(key)
+		if err != nil {
+			log.Printf("Skipped %s while indexing the storage: %s\n", key, err)
+			continue
+		}
+		node.Index.Put(info)
+	}
+	return nil
+}
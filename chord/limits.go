@@ -0,0 +1,258 @@
+package chord
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// Errors returned when a node refuses a request to protect itself from a peer.
+var (
+	ErrRateLimited = errors.New("rate limit exceeded")
+	ErrTooLarge    = errors.New("request too large")
+)
+
+const (
+	maxMessageSize = 1 << 20          // Maximum size of an RPC message, file contents are sent in parts
+	idleTimeout    = 30 * time.Second // Connections that neither read nor write for this long are closed
+	maxPeerBuckets = 4096             // Number of peers the rate limiter tracks before forgetting idle ones
+)
+
+// Rejections counts the requests and connections a node refused because of its limits.
+type Rejections struct {
+	Connections int64 // Connections is the number of connections closed because all slots were taken
+	Lookups     int64 // Lookups is the number of lookups refused because a client exceeded LookupRate
+	Stores      int64 // Stores is the number of stores refused because a peer exceeded StoreRate
+	Oversized   int64 // Oversized is the number of requests refused because they exceeded the size limits
+}
+
+func (r Rejections) String() string {
+	return fmt.Sprintf("%d connections, %d lookups, %d stores, %d oversized requests", r.Connections, r.Lookups, r.Stores, r.Oversized)
+}
+
+// limiter holds the state behind the limits of a node. The zero value has no peers and no rejections.
+type limiter struct {
+	connections atomic.Int64
+	lookups     atomic.Int64
+	stores      atomic.Int64
+	oversized   atomic.Int64
+
+	lookupRate rateLimiter
+	storeRate  rateLimiter
+}
+
+// Returns the number of requests and connections the node refused since it started.
+func (node *Node) Rejections() Rejections {
+	return Rejections{
+		Connections: node.limits.connections.Load(),
+		Lookups:     node.limits.lookups.Load(),
+		Stores:      node.limits.stores.Load(),
+		Oversized:   node.limits.oversized.Load(),
+	}
+}
+
+// Get the requests and connections a node refused
+func (node *Node) GetRejections(args *Empty, reply *Rejections) error {
+	*reply = node.Rejections()
+	return nil
+}
+
+// Checks that a peer may look up another key, counting the lookup against its rate.
+func (node *Node) allowLookup(peer string) error {
+	if !node.limits.lookupRate.allow(peer, node.LookupRate) {
+		node.limits.lookups.Add(1)
+		return fmt.Errorf("%w: %s exceeded %g lookups per second", ErrRateLimited, peer, node.LookupRate)
+	}
+	return nil
+}
+
+// Reports whether a caller is part of the ring rather than a client: the node itself or another node
+// on the same host, a node in the routing state of this node, or in cluster CA mode a node whose
+// certificate is issued for a node address. Lookups of ring peers maintain the ring, are forwarded
+// on behalf of clients or read the current version of objects they store, so they are not counted
+// against LookupRate.
+func (node *Node) isRingPeer(host string, cert *x509.Certificate) bool {
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	if isNodeCertificate(cert) {
+		return true
+	}
+	known := append([]NodeRef{{Address: node.Address}, node.Predecessor}, node.Successors...)
+	for _, ref := range append(known, node.FingerTable...) {
+		if ref.Address != "" && peerHost(ref.Address) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks that a peer may store another object, counting the store against its rate.
+func (node *Node) allowStore(peer string) error {
+	if !node.limits.storeRate.allow(peer, node.StoreRate) {
+		node.limits.stores.Add(1)
+		return fmt.Errorf("%w: %s exceeded %g stores per second", ErrRateLimited, peer, node.StoreRate)
+	}
+	return nil
+}
+
+// Checks that another node may store an object of the given size on this node.
+func (node *Node) checkSize(key string, size int64) error {
+	if node.MaxRequestSize > 0 && size > node.MaxRequestSize {
+		node.limits.oversized.Add(1)
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrTooLarge, key, size, node.MaxRequestSize)
+	}
+	return nil
+}
+
+// oversizeCounter is a gRPC stats handler that counts the RPC messages the server refused because
+// they exceeded maxMessageSize. gRPC refuses them before any method of the node is called.
+type oversizeCounter struct {
+	oversized *atomic.Int64
+}
+
+func (c oversizeCounter) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	end, ok := s.(*stats.End)
+	if !ok || end.Error == nil {
+		return
+	}
+	st := status.Convert(end.Error)
+	if st.Code() == codes.ResourceExhausted && strings.HasPrefix(st.Message(), "grpc: received message") {
+		c.oversized.Add(1)
+	}
+}
+
+func (c oversizeCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c oversizeCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c oversizeCounter) HandleConn(context.Context, stats.ConnStats) {}
+
+// Returns the host of a remote address, which identifies the peer for rate limiting.
+func peerHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// rateLimiter is a token bucket per peer. A peer may burst up to one second worth of requests.
+type rateLimiter struct {
+	mu    sync.Mutex
+	peers map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Takes a token from the bucket of a peer, refilled at rate tokens per second. A rate of 0 allows
+// every request.
+func (l *rateLimiter) allow(peer string, rate float64) bool {
+	if rate <= 0 {
+		return true
+	}
+	burst := max(rate, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.peers == nil {
+		l.peers = make(map[string]*bucket)
+	}
+	if len(l.peers) >= maxPeerBuckets {
+		l.forget(now, time.Duration(burst/rate*float64(time.Second)))
+	}
+	b, ok := l.peers[peer]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.peers[peer] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Forgets the peers whose buckets have been refilled, they are recreated full when needed.
+func (l *rateLimiter) forget(now time.Time, refill time.Duration) {
+	for peer, b := range l.peers {
+		if now.Sub(b.last) > refill {
+			delete(l.peers, peer)
+		}
+	}
+}
+
+// limitListener accepts at most a fixed number of concurrent connections. Connections beyond the
+// limit are closed right away instead of waiting, so a peer cannot queue up connections on the node.
+type limitListener struct {
+	net.Listener
+	slots    chan struct{}
+	rejected *atomic.Int64
+}
+
+// Limits the number of concurrent connections accepted by a listener. A limit of 0 accepts any
+// number of connections.
+func (node *Node) limitListener(ln net.Listener) net.Listener {
+	l := &limitListener{Listener: ln, rejected: &node.limits.connections}
+	if node.MaxConnections > 0 {
+		l.slots = make(chan struct{}, node.MaxConnections)
+	}
+	return l
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil || l.slots == nil {
+			return wrapConn(conn, nil), err
+		}
+		select {
+		case l.slots <- struct{}{}:
+			return wrapConn(conn, func() { <-l.slots }), nil
+		default:
+			l.rejected.Add(1)
+			log.Printf("Rejected connection from %s, all %d slots are taken\n", conn.RemoteAddr(), cap(l.slots))
+			conn.Close()
+		}
+	}
+}
+
+// limitedConn is an accepted connection that releases its slot when it is closed.
+type limitedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func wrapConn(conn net.Conn, release func()) net.Conn {
+	if conn == nil || release == nil {
+		return conn
+	}
+	return &limitedConn{Conn: conn, release: release}
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,88 @@
+package chord
+
+import (
+	"chord/chord/chordpb"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRingPeer(t *testing.T) {
+	node := &Node{
+		Address:     "10.0.0.1:8080",
+		Predecessor: NodeRef{Address: "10.0.0.2:8080"},
+		Successors:  []NodeRef{{Address: "10.0.0.3:8080"}, {}},
+		FingerTable: []NodeRef{{Address: "10.0.0.4:8080"}, {}},
+	}
+	issue := useTestCA(t)
+	block, _ := pem.Decode(issue("10.0.0.9:8080").PublicKey)
+	nodeCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert := &x509.Certificate{URIs: []*url.URL{{Scheme: "https", Host: "10.0.0.9"}}}
+
+	tests := []struct {
+		name string
+		host string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"loopback", "127.0.0.1", nil, true},
+		{"same host", "10.0.0.1", nil, true},
+		{"predecessor", "10.0.0.2", nil, true},
+		{"successor", "10.0.0.3", nil, true},
+		{"finger", "10.0.0.4", nil, true},
+		{"node certificate", "10.0.0.9", nodeCert, true},
+		{"client", "10.0.0.9", nil, false},
+		{"client certificate", "10.0.0.9", clientCert, false},
+		{"unknown caller", "", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := node.isRingPeer(test.host, test.cert); got != test.want {
+				t.Fatalf("isRingPeer(%q) = %v, want %v", test.host, got, test.want)
+			}
+		})
+	}
+}
+
+func TestOversizedRPCIsCounted(t *testing.T) {
+	node := &Node{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(1024), grpc.StatsHandler(oversizeCounter{&node.limits.oversized}))
+	chordpb.RegisterNodeServer(server, &rpcServer{node: node})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///"+listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = chordpb.NewNodeClient(conn).FindSuccessor(context.Background(), &chordpb.FindSuccessorRequest{Key: strings.Repeat("k", 2048)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("FindSuccessor() error = %v, want ResourceExhausted", err)
+	}
+	// The server counts the message after it sent the error
+	deadline := time.Now().Add(time.Second)
+	for node.Rejections().Oversized == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := node.Rejections().Oversized; got != 1 {
+		t.Fatalf("Rejections().Oversized = %d, want 1", got)
+	}
+}
@@ -0,0 +1,106 @@
+package chord
+
+import (
+	"bufio"
+	"crypto/tls"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const tlsHandshakeRecord = 0x16 // First byte of a TLS connection
+
+// Serves RPC and file transfers on one listener. Transfers and, in cluster CA mode, RPC connections
+// use TLS, other RPC connections are plaintext. Both are handed to the same gRPC server, which only
+// serves file transfers over TLS.
+func (node *Node) serveMux(listener net.Listener, server *grpc.Server) error {
+	rpcListener := newConnListener(listener.Addr())
+	defer rpcListener.Close()
+	go server.Serve(rpcListener)
+
+	config := serverTLSConfig()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go node.routeConnection(conn, config, rpcListener)
+	}
+}
+
+// Hands a connection to the RPC server, as a TLS connection if its first byte starts a TLS
+// handshake. The server runs the handshake, see connCredentials.
+func (node *Node) routeConnection(conn net.Conn, config *tls.Config, rpcListener *connListener) {
+	conn.SetDeadline(time.Now().Add(idleTimeout))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	buffered := &bufferedConn{Conn: conn, reader: reader}
+
+	if first[0] == tlsHandshakeRecord {
+		rpcListener.push(tls.Server(buffered, config))
+		return
+	}
+	if clusterCA != nil {
+		log.Printf("Rejected plaintext connection from %s in cluster CA mode\n", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	rpcListener.push(buffered)
+}
+
+// bufferedConn is a connection whose first bytes were already read into a buffer.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// connListener is a listener for connections accepted by another listener.
+type connListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{addr: addr, conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+// Hands a connection to the listener, closing it if the listener is closed.
+func (l *connListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,72 @@
+package chord
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Routes a connection on which the client sends data and returns the connection handed to the RPC
+// server, nil if the connection was closed instead.
+func routeTestConnection(t *testing.T, send func(conn net.Conn)) net.Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go send(client)
+
+	node := &Node{}
+	rpcListener := newConnListener(&net.TCPAddr{})
+	defer rpcListener.Close()
+	routed := make(chan struct{})
+	go func() {
+		node.routeConnection(server, &tls.Config{}, rpcListener)
+		close(routed)
+	}()
+
+	select {
+	case conn := <-rpcListener.conns:
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	case <-routed:
+		return nil
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was neither routed nor closed")
+		return nil
+	}
+}
+
+func TestRouteConnection(t *testing.T) {
+	handshake := func(conn net.Conn) {
+		tls.Client(conn, &tls.Config{InsecureSkipVerify: true}).Handshake()
+	}
+	plaintext := func(conn net.Conn) {
+		conn.Write([]byte("PRI * HTTP/2.0\r\n"))
+	}
+
+	conn := routeTestConnection(t, handshake)
+	if _, ok := conn.(*tls.Conn); !ok {
+		t.Fatalf("TLS connection routed as %T, want *tls.Conn", conn)
+	}
+
+	conn = routeTestConnection(t, plaintext)
+	if _, ok := conn.(*bufferedConn); !ok {
+		t.Fatalf("plaintext connection routed as %T, want *bufferedConn", conn)
+	}
+	// The peeked byte is still read by the server
+	data := make([]byte, 3)
+	_, err := io.ReadFull(conn, data)
+	if err != nil || string(data) != "PRI" {
+		t.Fatalf("routed connection reads %q, %v, want %q", data, err, "PRI")
+	}
+
+	// In cluster CA mode every connection must use TLS
+	useTestCA(t)
+	if conn := routeTestConnection(t, plaintext); conn != nil {
+		t.Fatalf("plaintext connection in cluster CA mode routed as %T, want it closed", conn)
+	}
+	if _, ok := routeTestConnection(t, handshake).(*tls.Conn); !ok {
+		t.Fatal("TLS connection in cluster CA mode was not routed")
+	}
+}
@@ -1,15 +1,22 @@
 package chord
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
-	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const redundancy = 3 // Number of copies by hashing the path to send it to different nodes.
+const (
+	joinInitialBackoff = 500 * time.Millisecond // Delay before the first join retry
+	joinMaxBackoff     = 30 * time.Second       // Upper bound for the delay between join retries
+)
 
 type Node struct {
 	ID                       string    // ID is the hash of the address
@@ -24,8 +31,28 @@ type Node struct {
 	R                        int       // R is the number of successors to keep in the successor list
 	M                        int       // M is the number of entries in the finger table, matches the identifier space
 	Next                     int       // Next is the next finger to fix
-	TLSAddress               string    // TLSAddress is the address to listen for TLS connections on
+	TLSAddress               string    // TLSAddress is the address other nodes transfer files to the node on
+	SinglePort               bool      // SinglePort is set if file transfers are served on the RPC port, TLSAddress is then Address
 	StoragePath              string    // StoragePath is the path to the storage directory
+	Storage                  Store     // Storage is the backend the node's objects are stored in
+	StatePath                string    // StatePath is the path to the file the routing state is checkpointed to
+	CheckpointInterval       int       // CheckpointInterval is the interval at which the node checkpoints its routing state
+	Index                    *KeyIndex // Index is the index of the keys in the storage directory
+	Replicas                 int       // Replicas is the number of copies stored of every file (N)
+	WriteQuorum              int       // WriteQuorum is the number of replicas that must acknowledge a write (W)
+	ReadQuorum               int       // ReadQuorum is the number of replicas consulted on a read (R)
+	QuotaBytes               int64     // QuotaBytes is the maximum total size of the objects stored on the node, 0 if unlimited
+	QuotaObjects             int       // QuotaObjects is the maximum number of objects stored on the node, 0 if unlimited
+	SweepInterval            int       // SweepInterval is the interval at which the node deletes expired objects
+	MaxConnections           int       // MaxConnections is the maximum number of concurrent connections on each listener, 0 if unlimited
+	LookupRate               float64   // LookupRate is the number of lookups per second allowed from every client, 0 if unlimited
+	StoreRate                float64   // StoreRate is the number of stores per second allowed from every peer, 0 if unlimited
+	MaxRequestSize           int64     // MaxRequestSize is the maximum size of an object another node may store on or send to the node, 0 if unlimited
+
+	writeLock sync.Mutex   // writeLock serializes writes to the storage
+	limits    limiter      // limits tracks the rate of every peer and the rejected requests
+	joined    chan NodeRef // joined hands the successor found by a background join to Stabilize
+	inRing    atomic.Bool  // inRing is set by Stabilize while the node has a successor other than itself
 }
 
 // Create a new node with the given address
@@ -33,11 +60,12 @@ func (node *Node) CreateNode() {
 	nodeRef := new(NodeRef)
 	nodeRef.TLSAddress = node.TLSAddress
 
-	file, err := os.ReadFile("./cert.pem")
+	_, err := certificates.load(node.Address)
 	if err != nil {
-		log.Fatal("Failed to read certificate file: \n Run: openssl req -x509 -newkey rsa:4096 -keyout key.pem -out cert.pem -days 365 -nodes \n To generate a cert.pem", err)
+		log.Fatal("Failed to load certificate: \n Supply one with -cert and -key, or remove both to generate them \n", err)
 	}
 
+	file := certificates.publicKey()
 	nodeRef.PublicKey = file
 	node.PublicKey = file
 	node.Successors[0] = *nodeRef
@@ -55,22 +83,75 @@ func (node *Node) StartIntervals() {
 	callOnInterval(node.StabilizeInterval, node.Stabilize)
 	callOnInterval(node.FixFingersInterval, node.FixFingers)
 	callOnInterval(node.CheckPredecessorInterval, node.CheckPredecessor)
+	callOnInterval(node.CheckpointInterval, node.Checkpoint)
+	callOnInterval(node.SweepInterval, node.SweepExpired)
+	callOnInterval(certWatchInterval, node.ReloadCertificate)
 }
 
-// Join an existing ring
-func (node *Node) Join(address string) {
-	args := new(FindSuccessorArgs)
-	args.Key = node.Address
-	reply := new(FindSuccessorReply)
-	log.Printf("Joining %s\n", address)
-	err := call("Node.FindSuccessor", address, args, reply)
-	if err != nil {
-		log.Fatal(err)
+// Join an existing ring through one of the bootstrap addresses. The addresses are tried in order and
+// retried with exponential backoff. If none of them answer, the node runs standalone and keeps trying
+// to join in the background until it succeeds or until another node has joined it.
+func (node *Node) Join(bootstrap []string) {
+	if successor, ok := node.joinAny(bootstrap); ok {
+		node.Successors[0] = successor
+		node.Start()
+		return
 	}
-	node.Successors[0] = reply.Successor
+
+	log.Printf("Could not reach any bootstrap node, running standalone\n")
+	node.joined = make(chan NodeRef, 1)
+	go node.retryJoin(bootstrap)
 	node.Start()
 }
 
+// Keeps retrying to join the ring with exponential backoff while the node is alone. The routing state
+// is only changed by Stabilize, so the successor that is found is handed to it through node.joined.
+func (node *Node) retryJoin(bootstrap []string) {
+	backoff := joinInitialBackoff
+	for {
+		time.Sleep(backoff)
+		if node.inRing.Load() {
+			log.Printf("Node is already part of a ring, stopped retrying join\n")
+			return
+		}
+		if successor, ok := node.joinAny(bootstrap); ok {
+			node.joined <- successor
+			return
+		}
+		backoff *= 2
+		if backoff > joinMaxBackoff {
+			backoff = joinMaxBackoff
+		}
+	}
+}
+
+// Tries to join the ring through each of the bootstrap addresses once. Returns the successor of the
+// node and true on success.
+func (node *Node) joinAny(bootstrap []string) (NodeRef, bool) {
+	for _, address := range bootstrap {
+		if address == node.Address {
+			continue
+		}
+		args := new(FindSuccessorArgs)
+		args.Key = node.ID
+		reply := new(FindSuccessorReply)
+		log.Printf("Joining %s\n", address)
+		err := remote(address).FindSuccessor(args, reply)
+		if err != nil {
+			log.Printf("Failed to join %s: %v\n", address, err)
+			continue
+		}
+		err = verifyNodeRef(reply.Successor)
+		if err != nil {
+			log.Printf("Failed to join %s: %v\n", address, err)
+			continue
+		}
+		log.Printf("Joined the ring through %s\n", address)
+		return reply.Successor, true
+	}
+	return NodeRef{}, false
+}
+
 func bytesToBigInt(b []byte) *big.Int {
 	return new(big.Int).SetBytes(b)
 }
@@ -85,12 +166,12 @@ func (node *Node) FindSuccessor(args *FindSuccessorArgs, reply *FindSuccessorRep
 		closestPrecedingNodeArgs := new(ClosestPrecedingNodeArgs)
 		closestPrecedingNodeArgs.Key = num.String()
 		closestPrecedingNodeReply := new(ClosestPrecedingNodeReply)
-		err := call("Node.ClosestPrecedingNode", node.Address, closestPrecedingNodeArgs, closestPrecedingNodeReply)
+		err := remote(node.Address).ClosestPrecedingNode(closestPrecedingNodeArgs, closestPrecedingNodeReply)
 		if err != nil {
 			return err
 		}
 
-		err = call("Node.FindSuccessor", closestPrecedingNodeReply.Node.Address, args, reply)
+		err = remote(closestPrecedingNodeReply.Node.Address).FindSuccessor(args, reply)
 		if err != nil {
 			return err
 		}
@@ -98,9 +179,10 @@ func (node *Node) FindSuccessor(args *FindSuccessorArgs, reply *FindSuccessorRep
 	return nil
 }
 
-// Notify a node that it may be its predecessor
+// Notify a node that it may be its predecessor. A notification from the current predecessor refreshes
+// its NodeRef, so that a new public key is picked up after a certificate rotation.
 func (node *Node) Notify(args *NotifyArgs, reply *Empty) error {
-	if node.Predecessor.Address == "" || between(Hash(node.Predecessor.Address), Hash(args.Key.Address), Hash(node.Address), false) {
+	if node.Predecessor.Address == "" || node.Predecessor.Address == args.Key.Address || between(Hash(node.Predecessor.Address), Hash(args.Key.Address), Hash(node.Address), false) {
 		node.Predecessor = args.Key
 	}
 	return nil
@@ -109,6 +191,7 @@ func (node *Node) Notify(args *NotifyArgs, reply *Empty) error {
 // Used to let someone inherit their successors successor list
 func (node *Node) GetSuccessorList(args *GetSuccessorlistArgs, reply *GetSuccessorlistReply) error {
 	reply.Successors = node.Successors
+	reply.Node = NodeRef{Address: node.Address, PublicKey: node.PublicKey, TLSAddress: node.TLSAddress}
 	return nil
 }
 
@@ -126,65 +209,251 @@ func (node *Node) ClosestPrecedingNode(args *ClosestPrecedingNodeArgs, reply *Cl
 	return nil
 }
 
-// Stores a file in the ring by finding the correct succesor and then using TLSSend to send the file to the successor.
-// We use redundancy to store the file on multiple nodes. This is done by hashing multiple times.
-func (node *Node) Store(path string, data []byte) error {
-	hashedPath := path
-	for i := 0; i < redundancy; i++ {
-		succArgs := new(FindSuccessorArgs)
-		if i == 0 {
-			hashedPath = path
-		} else {
-			for j := 0; j < i; j++ {
-				hashedPath = Hash(hashedPath).String()
-			}
-		}
-		succArgs.Key = hashedPath
-		succReply := new(FindSuccessorReply)
-		err := call("Node.FindSuccessor", node.Address, succArgs, succReply)
-		if err != nil {
-			return fmt.Errorf("failed to find successor: %w", err)
+// Stores a file in the ring by finding the correct succesors and then using TLSSend to send the file to them.
+// The file is stored on Replicas nodes, found by hashing the key multiple times, and the store succeeds
+// once WriteQuorum of them have acknowledged the write. The outcome of the write to every replica is returned,
+// with errors such as ErrQuotaExceeded or ErrNotOwner as reported by the replica.
+func (node *Node) Store(path string, data []byte, opts StoreOptions) ([]ReplicaResult, error) {
+	return node.storeObject(node.newObjectInfo(path, data, opts), data)
+}
+
+// StoreOptions are the options of a store that are kept in the metadata of the stored file.
+type StoreOptions struct {
+	Expires    time.Time   // Expires is the time the file expires and is deleted, zero if it never expires
+	Encryption *Encryption // Encryption describes how the contents were encrypted, nil if they are not encrypted
+	ACL        *ACL        // ACL is the ACL of the file if it is new, an existing file keeps its ACL
+}
+
+// Returns the options for the chunks and fragments of a file. They expire with the file and are
+// protected by its ACL, but only the file as a whole can be decrypted.
+func (opts StoreOptions) parts() StoreOptions {
+	return StoreOptions{Expires: opts.Expires, ACL: opts.ACL}
+}
+
+// Returns the ACL a file has once it is stored: the ACL of the stored file, which only changes
+// through SetACL, or acl for a new file.
+func (node *Node) fileACL(path string, acl *ACL) (*ACL, error) {
+	previous, err := node.statObject(path)
+	if errors.Is(err, ErrNotFound) {
+		return acl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return previous.ACL, nil
+}
+
+// Returns the options an object was stored with, to store it again.
+func (info ObjectInfo) storeOptions() StoreOptions {
+	return StoreOptions{Expires: info.Expires, Encryption: info.Encryption, ACL: info.ACL}
+}
+
+// Get a file and its metadata from the ring. ReadQuorum replicas are consulted and the newest version
+// is returned. Replicas that returned an older, missing or corrupt copy are repaired with it.
+// Files that were stored in chunks are reassembled, and files stored under their content key are verified against it.
+// Expired files are not found, even if they have not been swept yet.
+func (node *Node) GetFile(path string) ([]byte, ObjectInfo, error) {
+	data, info, err := node.getObject(path)
+	if err == nil && info.Expired(time.Now()) {
+		err = ErrNotFound
+	}
+	if err == nil && info.Manifest {
+		data, info, err = node.assembleChunks(data, info)
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return data, info, verifyContent(path, data)
+}
+
+// Get the metadata of the newest version of a file from ReadQuorum replicas.
+func (node *Node) StatFile(path string) (ObjectInfo, error) {
+	info, err := node.statObject(path)
+	if err == nil && info.Expired(time.Now()) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil || !info.Manifest {
+		return info, err
+	}
+	// The size and checksum of a chunked file are in its manifest
+	data, info, err := node.getObject(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	manifest, err := decodeManifest(data)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return manifest.apply(info), nil
+}
+
+// Returns the metadata for a new version of an object stored by this node.
+func (node *Node) newObjectInfo(key string, data []byte, opts StoreOptions) ObjectInfo {
+	now := time.Now()
+	return ObjectInfo{
+		Key:         key,
+		Name:        filepath.Base(key),
+		ContentType: contentType(key, data),
+		Created:     now,
+		Modified:    now,
+		Uploader:    node.Address,
+		Expires:     opts.Expires,
+		Encryption:  opts.Encryption,
+		ACL:         opts.ACL,
+	}
+}
+
+// Stores an object on its replicas as the next version of its key.
+func (node *Node) storeObject(info ObjectInfo, data []byte) ([]ReplicaResult, error) {
+	err := ValidateKey(info.Key)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := node.replicas(info.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Continue from the current version of the object if it is already stored. The new version
+	// replaces the current version and all of its concurrent siblings. A new vector is only started
+	// for a key that is not stored, starting over for a key that could not be read would write a
+	// version the replicas take for one they already have.
+	previous, err := node.statObject(info.Key)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		info.Version = 1
+		info.Vector = VersionVector{}.Increment(node.Address)
+	case err != nil:
+		return nil, fmt.Errorf("failed to read the current version of %s: %w", info.Key, err)
+	default:
+		if !previous.Deleted {
+			info.Created = previous.Created
 		}
-		TLSSend(succReply.Successor, path, data)
+		info.Version = previous.Version + 1
+		info.Vector = previous.CausalVector().Increment(node.Address)
+		// The ACL of a file only changes through SetACL
+		info.ACL = previous.ACL
 	}
-	return nil
+
+	return node.writeQuorum(replicas, info, data)
 }
 
-// Get a file from the ring. Since we are using redundancy, we can just get the file from the first node that has it.
-func (node *Node) GetFile(path string) ([]byte, error) {
-	for i := 0; i < redundancy; i++ {
+// Gets an object and its metadata from ReadQuorum of its replicas.
+func (node *Node) getObject(key string) ([]byte, ObjectInfo, error) {
+	replicas, err := node.replicas(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return node.readQuorum(replicas, key, true)
+}
+
+// Gets the metadata of an object from ReadQuorum of its replicas.
+func (node *Node) statObject(key string) (ObjectInfo, error) {
+	replicas, err := node.replicas(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	_, info, err := node.readQuorum(replicas, key, false)
+	return info, err
+}
+
+// Finds the distinct nodes responsible for the copies of a key.
+func (node *Node) replicas(key string) ([]NodeRef, error) {
+	var replicas []NodeRef
+	seen := make(map[string]bool)
+	for _, id := range replicaIDs(key, node.Replicas) {
 		succArgs := new(FindSuccessorArgs)
-		if i == 0 {
-			succArgs.Key = path
-		} else {
-			succArgs.Key = Hash(path).String()
-		}
+		succArgs.Key = id.String()
 		succReply := new(FindSuccessorReply)
-		err := call("Node.FindSuccessor", node.Address, succArgs, succReply)
+		err := remote(node.Address).FindSuccessor(succArgs, succReply)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find successor: %w", err)
 		}
-		data, err := TLSGet(succReply.Successor, path)
-		if err == nil {
-			return data, nil
+		if !seen[succReply.Successor.TLSAddress] {
+			seen[succReply.Successor.TLSAddress] = true
+			replicas = append(replicas, succReply.Successor)
 		}
 	}
-	return nil, fmt.Errorf("failed to get file\n")
+	return replicas, nil
+}
+
+// Returns the identifiers the n copies of a key are placed at. The first copy is placed at the hash
+// of the key and every following copy at the hash of the previous identifier.
+func replicaIDs(key string, n int) []*big.Int {
+	ids := make([]*big.Int, n)
+	ids[0] = Hash(key)
+	for i := 1; i < n; i++ {
+		ids[i] = Hash(ids[i-1].String())
+	}
+	return ids
+}
+
+// Checks if this node is responsible for one of the copies of an object, i.e. if one of its replica
+// identifiers is in (predecessor, node]. The object is placed on as many copies as the node that wrote
+// it stores, or as this node stores if that is unknown. Without a known predecessor the node assumes
+// it is responsible.
+func (node *Node) Owns(info ObjectInfo) bool {
+	if node.Predecessor.Address == "" {
+		return true
+	}
+	n := info.Replicas
+	if n <= 0 {
+		n = node.Replicas
+	}
+	for _, id := range replicaIDs(info.Key, n) {
+		if between(Hash(node.Predecessor.Address), id, Hash(node.Address), true) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists the keys stored on this node
+func (node *Node) ListKeys(args *ListKeysArgs, reply *ListKeysReply) error {
+	for _, entry := range node.Index.List() {
+		if args.OwnedOnly && !node.Owns(entry) {
+			continue
+		}
+		reply.Entries = append(reply.Entries, entry)
+	}
+	return nil
+}
+
+// Gets the digest of the keys stored on this node, used to compare replicas
+func (node *Node) GetDigest(args *Empty, reply *GetDigestReply) error {
+	reply.Digest = node.Index.Digest()
+	reply.Count = len(node.Index.List())
+	return nil
 }
 
 // Verifies the immediate successor and tells the successor about this node
 func (node *Node) Stabilize() {
+	// Take over the successor found by a background join, unless another node has joined this one
+	select {
+	case successor := <-node.joined:
+		if node.Successors[0].Address == node.Address {
+			node.Successors[0] = successor
+		}
+	default:
+	}
+	node.inRing.Store(node.Successors[0].Address != node.Address)
+
 	// Get predecessor of our successor
 	x := new(GetPredecessorReply)
 	x.Predecessor = node.Predecessor
 	if node.Successors[0].Address != node.Address {
 		x = new(GetPredecessorReply)
-		call("Node.GetPredecessor", node.Successors[0].Address, &Empty{}, x)
+		remote(node.Successors[0].Address).GetPredecessor(&Empty{}, x)
 	}
 
 	// If x is between this node and its successor, set successor to x
 	if x.Predecessor.Address != "" && between(Hash(node.Address), Hash(x.Predecessor.Address), Hash(node.Successors[0].Address), false) {
-		node.Successors[0] = x.Predecessor
+		err := verifyNodeRef(x.Predecessor)
+		if err != nil {
+			log.Printf("Ignoring predecessor %s of successor: %v\n", x.Predecessor.Address, err)
+		} else {
+			node.Successors[0] = x.Predecessor
+		}
 	}
 
 	// Ad-hoc fix for when the successor list is empty
@@ -194,8 +463,7 @@ func (node *Node) Stabilize() {
 
 	notifyArgs := new(NotifyArgs)
 	notifyArgs.Key = *&NodeRef{Address: node.Address, PublicKey: node.PublicKey, TLSAddress: node.TLSAddress}
-	notifyReply := new(NotifyReply)
-	err := call("Node.Notify", node.Successors[0].Address, notifyArgs, notifyReply)
+	err := remote(node.Successors[0].Address).Notify(notifyArgs, &Empty{})
 	if err != nil {
 		// If the successor is down, remove it from the successor list
 		node.Successors = node.Successors[1:]
@@ -210,18 +478,26 @@ func (node *Node) Stabilize() {
 	// Get successors from our successor
 	getSuccessorlistArgs := new(GetSuccessorlistArgs)
 	getSuccessorlistReply := new(GetSuccessorlistReply)
-	err = call("Node.GetSuccessorList", node.Successors[0].Address, getSuccessorlistArgs, getSuccessorlistReply)
+	err = remote(node.Successors[0].Address).GetSuccessorList(getSuccessorlistArgs, getSuccessorlistReply)
 	if err != nil {
 		return
 	}
 
-	successorlistReply := getSuccessorlistReply.Successors
-	if len(getSuccessorlistReply.Successors) >= node.R {
-		successorlistReply = successorlistReply[:node.R-1]
+	// Refresh the NodeRef of our successor, which changes when it rotates its certificate
+	successor := getSuccessorlistReply.Node
+	if successor.Address == node.Successors[0].Address && !bytes.Equal(successor.PublicKey, node.Successors[0].PublicKey) && verifyNodeRef(successor) == nil {
+		node.Successors[0] = successor
 	}
 
-	// Append our successor to the successor list
-	node.Successors = append([]NodeRef{node.Successors[0]}, successorlistReply...)
+	node.Successors = successorList(node.Successors[0], getSuccessorlistReply.Successors, node.R)
+}
+
+// Returns the successor list of a node: its successor followed by the verified entries of the
+// successor's own list, at most r entries in total.
+func successorList(successor NodeRef, list []NodeRef, r int) []NodeRef {
+	verified := verifiedNodeRefs(list)
+	verified = verified[:min(len(verified), r-1)]
+	return append([]NodeRef{successor}, verified...)
 }
 
 // Fix the finger table of a given node
@@ -241,7 +517,10 @@ func (node *Node) FixFingers() {
 	x := new(big.Int).Add(bigN, twoToThePower)
 	succArgs.Key = x.String()
 	succReply := new(FindSuccessorReply)
-	err := call("Node.FindSuccessor", node.Address, succArgs, succReply)
+	err := remote(node.Address).FindSuccessor(succArgs, succReply)
+	if err == nil {
+		err = verifyNodeRef(succReply.Successor)
+	}
 	if err != nil {
 		return
 	}
@@ -250,7 +529,7 @@ func (node *Node) FixFingers() {
 
 // Check the predecessor of a given node
 func (node *Node) CheckPredecessor() {
-	err := call("Node.Ping", node.Predecessor.Address, &Empty{}, &Empty{})
+	err := remote(node.Predecessor.Address).Ping(&Empty{}, &Empty{})
 	if err != nil {
 		node.Predecessor = NodeRef{}
 	}
@@ -260,10 +539,19 @@ func (node *Node) CheckPredecessor() {
 func (node *Node) GetInfo() string {
 	var info strings.Builder
 	info.WriteString("Node:\n")
-	info.WriteString(fmt.Sprintf("  ID: %s\n  Address: %s\n\n", node.ID, node.Address))
+	info.WriteString(fmt.Sprintf("  ID: %s\n  Address: %s\n  Usage: %s\n  Rejected: %s\n\n", node.ID, node.Address, node.Usage(), node.Rejections()))
 	info.WriteString("Successors:\n")
 	for _, s := range node.Successors {
-		info.WriteString(fmt.Sprintf("  ID: %s\n  Address: %s\n\n", Hash(s.Address), s.Address))
+		usage, rejected := "unavailable", "unavailable"
+		reply := new(Usage)
+		if remote(s.Address).GetCapacity(&Empty{}, reply) == nil {
+			usage = reply.String()
+		}
+		rejections := new(Rejections)
+		if remote(s.Address).GetRejections(&Empty{}, rejections) == nil {
+			rejected = rejections.String()
+		}
+		info.WriteString(fmt.Sprintf("  ID: %s\n  Address: %s\n  Usage: %s\n  Rejected: %s\n\n", Hash(s.Address), s.Address, usage, rejected))
 	}
 	info.WriteString("Fingers:\n")
 	for _, finger := range node.FingerTable {
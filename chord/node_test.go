@@ -0,0 +1,161 @@
+package chord
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Enables cluster CA mode with a new CA for the duration of a test. Returns a function that issues
+// NodeRefs with a certificate signed by the CA.
+func useTestCA(t *testing.T) func(address string) NodeRef {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	previous := clusterCA
+	clusterCA = pool
+	t.Cleanup(func() { clusterCA = previous })
+
+	serial := int64(1)
+	return func(address string) NodeRef {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial++
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: address},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			URIs:         []*url.URL{{Scheme: nodeURIScheme, Host: address}},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NodeRef{Address: address, PublicKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+	}
+}
+
+func addresses(refs []NodeRef) []string {
+	var addresses []string
+	for _, ref := range refs {
+		addresses = append(addresses, ref.Address)
+	}
+	return addresses
+}
+
+func TestSuccessorList(t *testing.T) {
+	issue := useTestCA(t)
+	successor := issue("10.0.0.1:8080")
+	a, b, c := issue("10.0.0.2:8080"), issue("10.0.0.3:8080"), issue("10.0.0.4:8080")
+	forged := NodeRef{Address: "10.0.0.5:8080", PublicKey: a.PublicKey}
+
+	tests := []struct {
+		name string
+		list []NodeRef
+		r    int
+		want []string
+	}{
+		{"new node with empty entries", []NodeRef{a, {}, {}}, 3, []string{successor.Address, a.Address}},
+		{"empty entries first", []NodeRef{{}, {}, a, b, c}, 3, []string{successor.Address, a.Address, b.Address}},
+		{"forged entry", []NodeRef{a, forged, b}, 3, []string{successor.Address, a.Address, b.Address}},
+		{"truncated", []NodeRef{a, b, c}, 3, []string{successor.Address, a.Address, b.Address}},
+		{"shorter than r", []NodeRef{a}, 5, []string{successor.Address, a.Address}},
+		{"only invalid entries", []NodeRef{{}, forged}, 3, []string{successor.Address}},
+		{"single successor", []NodeRef{a, b}, 1, []string{successor.Address}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := addresses(successorList(successor, test.list, test.r))
+			if len(got) != len(test.want) {
+				t.Fatalf("successorList() = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("successorList() = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOwnsUsesReplicasOfWriter(t *testing.T) {
+	node := &Node{Address: "10.0.0.1:8080", Predecessor: NodeRef{Address: "10.0.0.2:8080"}, Replicas: 1}
+	inRange := func(id *big.Int) bool {
+		return between(Hash(node.Predecessor.Address), id, Hash(node.Address), true)
+	}
+	// Find a key whose second copy is placed on the node, but not its first
+	key := ""
+	for i := 0; i < 10000 && key == ""; i++ {
+		ids := replicaIDs(fmt.Sprintf("file-%d", i), 2)
+		if !inRange(ids[0]) && inRange(ids[1]) {
+			key = fmt.Sprintf("file-%d", i)
+		}
+	}
+	if key == "" {
+		t.Fatal("no key with only its second copy on the node")
+	}
+
+	if node.Owns(ObjectInfo{Key: key}) {
+		t.Fatalf("Owns(%s) with one local copy = true, want false", key)
+	}
+	if !node.Owns(ObjectInfo{Key: key, Replicas: 2}) {
+		t.Fatalf("Owns(%s) written with two copies = false, want true", key)
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	node := &Node{
+		Address:     "10.0.0.1:8080",
+		StatePath:   filepath.Join(dir, "state.json"),
+		Successors:  []NodeRef{{Address: "10.0.0.2:8080"}, {Address: "10.0.0.1:8080"}},
+		Predecessor: NodeRef{Address: "10.0.0.3:8080"},
+	}
+	node.Checkpoint()
+	peers, err := node.LoadState()
+	if err != nil || strings.Join(peers, ",") != "10.0.0.2:8080,10.0.0.3:8080" {
+		t.Fatalf("LoadState() = %v, %v", peers, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("state directory has %d entries, %v, want only the checkpoint", len(entries), err)
+	}
+}
@@ -0,0 +1,123 @@
+package chord
+
+import (
+	"chord/chord/chordpb"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Conversions between the types of the node and the protocol buffer messages of the RPC protocol.
+
+func toProtoNodeRef(ref NodeRef) *chordpb.NodeRef {
+	return &chordpb.NodeRef{Address: ref.Address, PublicKey: ref.PublicKey, TlsAddress: ref.TLSAddress}
+}
+
+func fromProtoNodeRef(ref *chordpb.NodeRef) NodeRef {
+	return NodeRef{Address: ref.GetAddress(), PublicKey: ref.GetPublicKey(), TLSAddress: ref.GetTlsAddress()}
+}
+
+func fromProtoNodeRefs(refs []*chordpb.NodeRef) []NodeRef {
+	nodeRefs := make([]NodeRef, len(refs))
+	for i, ref := range refs {
+		nodeRefs[i] = fromProtoNodeRef(ref)
+	}
+	return nodeRefs
+}
+
+func toProtoNodeRefs(refs []NodeRef) []*chordpb.NodeRef {
+	nodeRefs := make([]*chordpb.NodeRef, len(refs))
+	for i, ref := range refs {
+		nodeRefs[i] = toProtoNodeRef(ref)
+	}
+	return nodeRefs
+}
+
+func toProtoObjectInfo(info ObjectInfo) *chordpb.ObjectInfo {
+	msg := &chordpb.ObjectInfo{
+		Key:         info.Key,
+		Name:        info.Name,
+		Size:        info.Size,
+		Checksum:    info.Checksum,
+		ContentType: info.ContentType,
+		Created:     toProtoTime(info.Created),
+		Modified:    toProtoTime(info.Modified),
+		Uploader:    info.Uploader,
+		Version:     info.Version,
+		Vector:      info.Vector,
+		Manifest:    info.Manifest,
+		Fragment:    info.Fragment,
+		Expires:     toProtoTime(info.Expires),
+		Deleted:     info.Deleted,
+		References:  info.References,
+		Replicas:    int32(info.Replicas),
+	}
+	for _, sibling := range info.Siblings {
+		msg.Siblings = append(msg.Siblings, &chordpb.Sibling{
+			Checksum: sibling.Checksum,
+			Size:     sibling.Size,
+			Modified: toProtoTime(sibling.Modified),
+			Uploader: sibling.Uploader,
+			Vector:   sibling.Vector,
+		})
+	}
+	if info.Encryption != nil {
+		msg.Encryption = &chordpb.Encryption{Algorithm: info.Encryption.Algorithm, Nonce: info.Encryption.Nonce, Salt: info.Encryption.Salt}
+	}
+	if info.ACL != nil {
+		msg.Acl = &chordpb.ACL{Owner: info.ACL.Owner, Readers: info.ACL.Readers, Writers: info.ACL.Writers}
+	}
+	return msg
+}
+
+func fromProtoObjectInfo(msg *chordpb.ObjectInfo) ObjectInfo {
+	info := ObjectInfo{
+		Key:         msg.GetKey(),
+		Name:        msg.GetName(),
+		Size:        msg.GetSize(),
+		Checksum:    msg.GetChecksum(),
+		ContentType: msg.GetContentType(),
+		Created:     fromProtoTime(msg.GetCreated()),
+		Modified:    fromProtoTime(msg.GetModified()),
+		Uploader:    msg.GetUploader(),
+		Version:     msg.GetVersion(),
+		Vector:      msg.GetVector(),
+		Manifest:    msg.GetManifest(),
+		Fragment:    msg.GetFragment(),
+		Expires:     fromProtoTime(msg.GetExpires()),
+		Deleted:     msg.GetDeleted(),
+		References:  msg.GetReferences(),
+		Replicas:    int(msg.GetReplicas()),
+	}
+	for _, sibling := range msg.GetSiblings() {
+		info.Siblings = append(info.Siblings, Sibling{
+			Checksum: sibling.GetChecksum(),
+			Size:     sibling.GetSize(),
+			Modified: fromProtoTime(sibling.GetModified()),
+			Uploader: sibling.GetUploader(),
+			Vector:   sibling.GetVector(),
+		})
+	}
+	if encryption := msg.GetEncryption(); encryption != nil {
+		info.Encryption = &Encryption{Algorithm: encryption.GetAlgorithm(), Nonce: encryption.GetNonce(), Salt: encryption.GetSalt()}
+	}
+	if acl := msg.GetAcl(); acl != nil {
+		info.ACL = &ACL{Owner: acl.GetOwner(), Readers: acl.GetReaders(), Writers: acl.GetWriters()}
+	}
+	return info
+}
+
+// Zero times, such as the expiry of an object that never expires, are left unset.
+func toProtoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func fromProtoTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime().Local()
+}
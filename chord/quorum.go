@@ -0,0 +1,135 @@
+package chord
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// The response of a replica to a quorum read.
+type readResult struct {
+	replica NodeRef
+	data    []byte
+	info    ObjectInfo
+	err     error
+}
+
+// ReplicaResult is the outcome of a write to one replica.
+type ReplicaResult struct {
+	Replica NodeRef // Replica is the node the write was sent to
+	Done    bool    // Done is false if the replica had not answered when the write quorum was reached
+	Err     error   // Err is the error reported by or for the replica, nil if it acknowledged the write
+}
+
+// Sends a file to the replicas in parallel and returns once WriteQuorum of them have acknowledged
+// the write, with the outcome of every write so far. The remaining writes continue in the background.
+// The replicas check that they own the file against the number of copies of this node, so that
+// nodes started with a different -n still accept the copies placed on them.
+func (node *Node) writeQuorum(replicas []NodeRef, info ObjectInfo, data []byte) ([]ReplicaResult, error) {
+	info.Replicas = node.Replicas
+	type indexedResult struct {
+		i   int
+		err error
+	}
+	done := make(chan indexedResult, len(replicas))
+	for i, replica := range replicas {
+		go func(i int, replica NodeRef) {
+			done <- indexedResult{i, TLSSend(replica, info, data)}
+		}(i, replica)
+	}
+
+	results := make([]ReplicaResult, len(replicas))
+	for i, replica := range replicas {
+		results[i].Replica = replica
+	}
+	acks := 0
+	var errs []error
+	for range replicas {
+		result := <-done
+		results[result.i].Done = true
+		results[result.i].Err = result.err
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", replicas[result.i].TLSAddress, result.err))
+			continue
+		}
+		acks++
+		if acks >= node.WriteQuorum {
+			return results, nil
+		}
+	}
+	return results, fmt.Errorf("write quorum not reached, %d of %d replicas acknowledged: %w", acks, node.WriteQuorum, errors.Join(errs...))
+}
+
+// Reads a file, or only its metadata, from the replicas in parallel until ReadQuorum of them have
+// answered, and returns the newest version. Replicas that answered with an older version, without
+// the file or with a corrupt copy are repaired with the newest version when the data was read.
+func (node *Node) readQuorum(replicas []NodeRef, key string, withData bool) ([]byte, ObjectInfo, error) {
+	results := make(chan readResult, len(replicas))
+	for _, replica := range replicas {
+		go func(replica NodeRef) {
+			result := readResult{replica: replica}
+			if withData {
+				result.data, result.info, result.err = TLSGet(replica, key, node.MaxRequestSize)
+			} else {
+				result.info, result.err = TLSStat(replica, key)
+			}
+			results <- result
+		}(replica)
+	}
+
+	var answers []readResult
+	var newest *readResult
+	var errs []error
+	for range replicas {
+		result := <-results
+		switch {
+		case result.err == nil:
+			if newest == nil {
+				newest = &result
+			} else {
+				newest = newerVersion(*newest, result)
+			}
+		case errors.Is(result.err, ErrNotFound) || errors.Is(result.err, ErrChecksum):
+			log.Printf("Replica of %s on %s: %v\n", key, result.replica.TLSAddress, result.err)
+		default:
+			// The replica did not answer and does not count towards the quorum
+			errs = append(errs, fmt.Errorf("%s: %w", result.replica.TLSAddress, result.err))
+			continue
+		}
+		answers = append(answers, result)
+		if len(answers) >= node.ReadQuorum && newest != nil {
+			break
+		}
+	}
+
+	if newest == nil {
+		if len(answers) >= node.ReadQuorum {
+			return nil, ObjectInfo{}, ErrNotFound
+		}
+		return nil, ObjectInfo{}, fmt.Errorf("read quorum not reached, %d of %d replicas answered: %w", len(answers), node.ReadQuorum, errors.Join(errs...))
+	}
+
+	if withData {
+		for _, answer := range answers {
+			if answer.err != nil || answer.info.Checksum != newest.info.Checksum || answer.info.Vector.Compare(newest.info.Vector) != Equal {
+				log.Printf("Repairing replica of %s on %s\n", key, answer.replica.TLSAddress)
+				go TLSSend(answer.replica, newest.info, newest.data)
+			}
+		}
+	}
+	return newest.data, newest.info, nil
+}
+
+// Picks the newer of two versions of a file the same way replicas resolve writes, so that
+// concurrent versions are reported as siblings.
+func newerVersion(current readResult, candidate readResult) *readResult {
+	info, action := resolveWrite(current.info, candidate.info)
+	switch action {
+	case storeIncoming:
+		candidate.info = info
+		return &candidate
+	case updateStored:
+		current.info = info
+	}
+	return &current
+}
@@ -0,0 +1,67 @@
+package chord
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Usage describes how much of its quota a node is using.
+type Usage struct {
+	UsedBytes    int64 // UsedBytes is the total size of the stored objects
+	UsedObjects  int   // UsedObjects is the number of stored objects
+	QuotaBytes   int64 // QuotaBytes is the maximum total size of the stored objects, 0 if unlimited
+	QuotaObjects int   // QuotaObjects is the maximum number of stored objects, 0 if unlimited
+}
+
+// Returns the usage of this node. Tombstones of expired objects are not counted.
+func (node *Node) Usage() Usage {
+	usage := Usage{QuotaBytes: node.QuotaBytes, QuotaObjects: node.QuotaObjects}
+	for _, entry := range node.Index.List() {
+		if entry.Deleted {
+			continue
+		}
+		usage.UsedBytes += entry.Size
+		usage.UsedObjects++
+	}
+	return usage
+}
+
+// Get the capacity and usage of a node
+func (node *Node) GetCapacity(args *Empty, reply *Usage) error {
+	*reply = node.Usage()
+	return nil
+}
+
+// Checks that storing an object of the given size under a key stays within the quota. The object
+// replaces the current object stored under the key, if any.
+func (node *Node) checkQuota(key string, size int64) error {
+	usage := node.Usage()
+	current, exists := node.Index.Get(key)
+	if exists && !current.Deleted {
+		usage.UsedBytes -= current.Size
+	} else {
+		usage.UsedObjects++
+	}
+	usage.UsedBytes += size
+
+	if usage.QuotaBytes > 0 && usage.UsedBytes > usage.QuotaBytes {
+		return fmt.Errorf("%w: %s would use %d of %d bytes", ErrQuotaExceeded, key, usage.UsedBytes, usage.QuotaBytes)
+	}
+	if usage.QuotaObjects > 0 && usage.UsedObjects > usage.QuotaObjects {
+		return fmt.Errorf("%w: %s would use %d of %d objects", ErrQuotaExceeded, key, usage.UsedObjects, usage.QuotaObjects)
+	}
+	return nil
+}
+
+func (usage Usage) String() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%d bytes", usage.UsedBytes))
+	if usage.QuotaBytes > 0 {
+		b.WriteString(fmt.Sprintf(" of %d (%.0f%%)", usage.QuotaBytes, 100*float64(usage.UsedBytes)/float64(usage.QuotaBytes)))
+	}
+	b.WriteString(fmt.Sprintf(", %d objects", usage.UsedObjects))
+	if usage.QuotaObjects > 0 {
+		b.WriteString(fmt.Sprintf(" of %d (%.0f%%)", usage.QuotaObjects, 100*float64(usage.UsedObjects)/float64(usage.QuotaObjects)))
+	}
+	return b.String()
+}
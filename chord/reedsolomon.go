@@ -0,0 +1,232 @@
+package chord
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errTooFewFragments = errors.New("too few fragments to reconstruct")
+
+// Arithmetic in GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1, using log and exp tables.
+var gfExp, gfLog = gfTables()
+
+func gfTables() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// reedSolomon is a systematic Reed-Solomon code with k data fragments and m parity fragments. The
+// parity fragments are computed with a Cauchy matrix, so that any k of the k+m fragments are enough
+// to reconstruct the data.
+type reedSolomon struct {
+	k, m   int
+	matrix [][]byte // matrix is the (k+m)×k encoding matrix, the identity on top of the Cauchy matrix
+}
+
+func newReedSolomon(k, m int) (*reedSolomon, error) {
+	if k < 1 || m < 0 || k+m > 256 {
+		return nil, fmt.Errorf("invalid erasure coding %d+%d", k, m)
+	}
+	matrix := make([][]byte, k+m)
+	for i := range matrix {
+		matrix[i] = make([]byte, k)
+		for j := 0; j < k; j++ {
+			if i < k {
+				if i == j {
+					matrix[i][j] = 1
+				}
+			} else {
+				// x_i = i and y_j = j are distinct for every row and column, so x_i + y_j is never 0
+				matrix[i][j] = gfInv(byte(i) ^ byte(j))
+			}
+		}
+	}
+	return &reedSolomon{k: k, m: m, matrix: matrix}, nil
+}
+
+// Splits data into k data fragments of equal size, padding the last one with zeros, and computes the
+// m parity fragments.
+func (rs *reedSolomon) Encode(data []byte) [][]byte {
+	size := (len(data) + rs.k - 1) / rs.k
+	if size == 0 {
+		size = 1
+	}
+	fragments := make([][]byte, rs.k+rs.m)
+	for i := 0; i < rs.k; i++ {
+		fragments[i] = make([]byte, size)
+		start := min(i*size, len(data))
+		copy(fragments[i], data[start:min(start+size, len(data))])
+	}
+	for i := rs.k; i < rs.k+rs.m; i++ {
+		fragments[i] = rs.combine(rs.matrix[i], fragments[:rs.k])
+	}
+	return fragments
+}
+
+// Reconstructs the missing fragments, given as nil, from any k of the others.
+func (rs *reedSolomon) Reconstruct(fragments [][]byte) error {
+	if len(fragments) != rs.k+rs.m {
+		return fmt.Errorf("expected %d fragments, got %d", rs.k+rs.m, len(fragments))
+	}
+	_, err := fragmentLength(fragments)
+	if err != nil {
+		return err
+	}
+
+	// Pick k available fragments and invert the rows of the encoding matrix they were created with
+	var rows [][]byte
+	var available [][]byte
+	for i, fragment := range fragments {
+		if fragment != nil && len(rows) < rs.k {
+			rows = append(rows, rs.matrix[i])
+			available = append(available, fragment)
+		}
+	}
+	if len(rows) < rs.k {
+		return errTooFewFragments
+	}
+	decode, err := invertMatrix(rows)
+	if err != nil {
+		return err
+	}
+
+	data := make([][]byte, rs.k)
+	for i := 0; i < rs.k; i++ {
+		if fragments[i] != nil {
+			data[i] = fragments[i]
+		} else {
+			data[i] = rs.combine(decode[i], available)
+		}
+	}
+	for i := range fragments {
+		if fragments[i] == nil {
+			if i < rs.k {
+				fragments[i] = data[i]
+			} else {
+				fragments[i] = rs.combine(rs.matrix[i], data)
+			}
+		}
+	}
+	return nil
+}
+
+// Joins the data fragments and strips the padding. All k+m fragments must be present, with the same
+// length, and the size must fit in the data fragments.
+func (rs *reedSolomon) Join(fragments [][]byte, size int64) ([]byte, error) {
+	if len(fragments) != rs.k+rs.m {
+		return nil, fmt.Errorf("expected %d fragments, got %d", rs.k+rs.m, len(fragments))
+	}
+	for i, fragment := range fragments {
+		if fragment == nil {
+			return nil, fmt.Errorf("fragment %d is missing", i)
+		}
+	}
+	length, err := fragmentLength(fragments)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size > int64(rs.k)*int64(length) {
+		return nil, fmt.Errorf("invalid size %d for %d fragments of %d bytes", size, rs.k, length)
+	}
+
+	data := make([]byte, 0, size)
+	for i := 0; i < rs.k && int64(len(data)) < size; i++ {
+		data = append(data, fragments[i]...)
+	}
+	return data[:size], nil
+}
+
+// Returns the length of the fragments that are present, which must all have the same length.
+func fragmentLength(fragments [][]byte) (int, error) {
+	length := -1
+	for i, fragment := range fragments {
+		if fragment == nil {
+			continue
+		}
+		if length >= 0 && len(fragment) != length {
+			return 0, fmt.Errorf("fragment %d is %d bytes, expected %d", i, len(fragment), length)
+		}
+		length = len(fragment)
+	}
+	return max(length, 0), nil
+}
+
+// Returns the linear combination of the fragments with the coefficients of a matrix row.
+func (rs *reedSolomon) combine(row []byte, fragments [][]byte) []byte {
+	out := make([]byte, len(fragments[0]))
+	for j, coefficient := range row {
+		if coefficient == 0 {
+			continue
+		}
+		for b, value := range fragments[j] {
+			out[b] ^= gfMul(coefficient, value)
+		}
+	}
+	return out
+}
+
+// Inverts a square matrix over GF(2^8) with Gauss-Jordan elimination.
+func invertMatrix(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	work := make([][]byte, n)
+	for i := range matrix {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], matrix[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("singular matrix")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := gfInv(work[col][col])
+		for j := range work[col] {
+			work[col][j] = gfMul(work[col][j], scale)
+		}
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			factor := work[row][col]
+			for j := range work[row] {
+				work[row][j] ^= gfMul(factor, work[col][j])
+			}
+		}
+	}
+
+	inverse := make([][]byte, n)
+	for i := range work {
+		inverse[i] = work[i][n:]
+	}
+	return inverse, nil
+}
@@ -0,0 +1,62 @@
+package chord
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReedSolomonRoundTrip(t *testing.T) {
+	rs, err := newReedSolomon(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("any four of the six fragments are enough")
+	fragments := rs.Encode(data)
+	fragments[0], fragments[5] = nil, nil
+
+	err = rs.Reconstruct(fragments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := rs.Join(fragments, int64(len(data)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Join() = %q, %v, want %q", got, err, data)
+	}
+}
+
+func TestReedSolomonInvalidFragments(t *testing.T) {
+	rs, err := newReedSolomon(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("0123456789")
+	encode := func() [][]byte { return rs.Encode(data) }
+
+	tests := []struct {
+		name      string
+		fragments [][]byte
+		size      int64
+	}{
+		{"too few fragments", encode()[:2], 10},
+		{"too many fragments", append(encode(), []byte("12345")), 10},
+		{"missing fragment", [][]byte{encode()[0], nil, encode()[2]}, 10},
+		{"unequal lengths", [][]byte{encode()[0], []byte("567"), encode()[2]}, 10},
+		{"negative size", encode(), -1},
+		{"size beyond the data fragments", encode(), 11},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := rs.Join(test.fragments, test.size)
+			if err == nil {
+				t.Fatal("Join() succeeded, want an error")
+			}
+		})
+	}
+
+	fragments := encode()
+	fragments[0], fragments[2] = nil, append(fragments[2], 0)
+	err = rs.Reconstruct(fragments)
+	if err == nil {
+		t.Fatal("Reconstruct() of fragments with unequal lengths succeeded, want an error")
+	}
+}
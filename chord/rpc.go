@@ -1,12 +1,27 @@
 package chord
 
 import (
+	"chord/chord/chordpb"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"net/http"
-	"net/rpc"
 	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type Empty struct{}
@@ -33,10 +48,6 @@ type NotifyArgs struct {
 	Key NodeRef
 }
 
-type NotifyReply struct {
-	Success bool
-}
-
 type ClosestPrecedingNodeArgs struct {
 	Key string
 }
@@ -48,6 +59,7 @@ type ClosestPrecedingNodeReply struct {
 type GetSuccessorlistArgs struct{}
 type GetSuccessorlistReply struct {
 	Successors []NodeRef
+	Node       NodeRef // Node is the node that answered, with its current public key
 }
 
 type StoreFileArgs struct {
@@ -59,9 +71,26 @@ type StoreFileReply struct {
 	Success bool
 }
 
+type ListKeysArgs struct {
+	OwnedOnly bool
+}
+
+type ListKeysReply struct {
+	Entries []ObjectInfo
+}
+
+type GetDigestReply struct {
+	Digest string
+	Count  int
+}
+
+const rpcTimeout = 10 * time.Second // Deadline of an RPC call to another node
+
+// Serves the RPC methods of the node as the gRPC Node service defined in chordpb/chord.proto. In
+// cluster CA mode they are served over mutual TLS, with the certificate of the calling node available
+// to the methods. The same server takes the file transfers of other nodes on the TLS port, or on the
+// same port with SinglePort. At most MaxConnections connections are served at once on each port.
 func (node *Node) ServeAndListen() {
-	rpc.Register(node)
-	rpc.HandleHTTP()
 	port := node.Address[strings.Index(node.Address, ":")+1:]
 	addr := fmt.Sprintf("0.0.0.0:%s", port)
 	listener, err := net.Listen("tcp", addr)
@@ -69,20 +98,479 @@ func (node *Node) ServeAndListen() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	log.Printf("Listening on %s\n", listener.Addr().String())
-	err = http.Serve(listener, nil)
+	server := grpc.NewServer(
+		// The listeners run the TLS handshake, see connCredentials
+		grpc.Creds(connCredentials{credentials.NewTLS(serverTLSConfig())}),
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.StatsHandler(oversizeCounter{&node.limits.oversized}),
+		grpc.ConnectionTimeout(idleTimeout),
+		grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: idleTimeout}),
+	)
+	chordpb.RegisterNodeServer(server, &rpcServer{node: node})
+	reflection.Register(server)
+
+	if node.SinglePort {
+		log.Printf("Listening on %s for RPC and file transfers\n", listener.Addr().String())
+		err = node.serveMux(node.limitListener(listener), server)
+	} else {
+		go node.serveTLS(server)
+		log.Printf("Listening on %s\n", listener.Addr().String())
+		ln := node.limitListener(listener)
+		if clusterCA != nil {
+			ln = tls.NewListener(ln, serverTLSConfig())
+		}
+		err = server.Serve(ln)
+	}
+	if err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
+// rpcServer serves the RPC methods of a node, converting between the protocol buffer messages and
+// the types of the node.
+type rpcServer struct {
+	chordpb.UnimplementedNodeServer
+	node *Node
+}
+
+// Find the successor of a given key, if the caller is a ring peer or has not exceeded its lookup rate.
+func (s *rpcServer) FindSuccessor(ctx context.Context, req *chordpb.FindSuccessorRequest) (*chordpb.FindSuccessorResponse, error) {
+	err := s.allowLookup(ctx)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	reply := new(FindSuccessorReply)
+	err = s.node.FindSuccessor(&FindSuccessorArgs{Key: req.GetKey()}, reply)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.FindSuccessorResponse{Successor: toProtoNodeRef(reply.Successor)}, nil
+}
+
+func (s *rpcServer) ClosestPrecedingNode(ctx context.Context, req *chordpb.ClosestPrecedingNodeRequest) (*chordpb.ClosestPrecedingNodeResponse, error) {
+	reply := new(ClosestPrecedingNodeReply)
+	err := s.node.ClosestPrecedingNode(&ClosestPrecedingNodeArgs{Key: req.GetKey()}, reply)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.ClosestPrecedingNodeResponse{Node: toProtoNodeRef(reply.Node)}, nil
+}
+
+// Notify a node that it may be its predecessor. In cluster CA mode the calling node must be the node
+// it claims to be.
+func (s *rpcServer) Notify(ctx context.Context, req *chordpb.NotifyRequest) (*chordpb.NotifyResponse, error) {
+	args := &NotifyArgs{Key: fromProtoNodeRef(req.GetNode())}
+	if clusterCA != nil {
+		err := fmt.Errorf("%w: no client certificate", ErrIdentity)
+		if cert := peerCertificate(ctx); cert != nil {
+			err = verifyPeer(cert, args.Key)
+		}
+		if err != nil {
+			log.Printf("Rejected notify from %s: %v\n", args.Key.Address, err)
+			return nil, rpcError(err)
+		}
+	}
+	err := s.node.Notify(args, &Empty{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.NotifyResponse{}, nil
 }
 
-func call(method string, address string, args any, reply any) error {
-	conn, err := rpc.DialHTTP("tcp", address)
+func (s *rpcServer) GetPredecessor(ctx context.Context, req *chordpb.GetPredecessorRequest) (*chordpb.GetPredecessorResponse, error) {
+	reply := new(GetPredecessorReply)
+	err := s.node.GetPredecessor(&Empty{}, reply)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.GetPredecessorResponse{Predecessor: toProtoNodeRef(reply.Predecessor)}, nil
+}
+
+func (s *rpcServer) GetSuccessorList(ctx context.Context, req *chordpb.GetSuccessorListRequest) (*chordpb.GetSuccessorListResponse, error) {
+	reply := new(GetSuccessorlistReply)
+	err := s.node.GetSuccessorList(&GetSuccessorlistArgs{}, reply)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.GetSuccessorListResponse{Successors: toProtoNodeRefs(reply.Successors), Node: toProtoNodeRef(reply.Node)}, nil
+}
+
+func (s *rpcServer) Ping(ctx context.Context, req *chordpb.PingRequest) (*chordpb.PingResponse, error) {
+	err := s.node.Ping(&Empty{}, &Empty{})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.PingResponse{}, nil
+}
+
+// Streams the metadata of the keys stored on the node, one message per key. Keys whose ACL does not
+// let the caller read their metadata are left out.
+func (s *rpcServer) ListKeys(req *chordpb.ListKeysRequest, stream chordpb.Node_ListKeysServer) error {
+	reply := new(ListKeysReply)
+	err := s.node.ListKeys(&ListKeysArgs{OwnedOnly: req.GetOwnedOnly()}, reply)
+	if err != nil {
+		return rpcError(err)
+	}
+	principal := rpcPrincipal(stream.Context())
+	for _, entry := range reply.Entries {
+		if !entry.ACL.CanStat(principal) {
+			continue
+		}
+		err = stream.Send(toProtoObjectInfo(entry))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the digest of the keys stored on the node. The digest covers every key, so in cluster CA mode
+// only nodes may get it.
+func (s *rpcServer) GetDigest(ctx context.Context, req *chordpb.GetDigestRequest) (*chordpb.GetDigestResponse, error) {
+	if clusterCA != nil && !isNodeCertificate(peerCertificate(ctx)) {
+		return nil, rpcError(fmt.Errorf("%w: only nodes may get the digest of the keys", ErrPermission))
+	}
+	reply := new(GetDigestReply)
+	err := s.node.GetDigest(&Empty{}, reply)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.GetDigestResponse{Digest: reply.Digest, Count: int64(reply.Count)}, nil
+}
+
+func (s *rpcServer) GetCapacity(ctx context.Context, req *chordpb.GetCapacityRequest) (*chordpb.Usage, error) {
+	usage := new(Usage)
+	err := s.node.GetCapacity(&Empty{}, usage)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.Usage{UsedBytes: usage.UsedBytes, UsedObjects: int64(usage.UsedObjects), QuotaBytes: usage.QuotaBytes, QuotaObjects: int64(usage.QuotaObjects)}, nil
+}
+
+func (s *rpcServer) GetRejections(ctx context.Context, req *chordpb.GetRejectionsRequest) (*chordpb.Rejections, error) {
+	rejections := new(Rejections)
+	err := s.node.GetRejections(&Empty{}, rejections)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &chordpb.Rejections{Connections: rejections.Connections, Lookups: rejections.Lookups, Stores: rejections.Stores, Oversized: rejections.Oversized}, nil
+}
+
+// The gRPC status codes the errors of the node are reported with. The reason in the ErrorDetail of
+// the status tells apart errors with the same code, so that the calling node gets the error back.
+var rpcErrors = []struct {
+	err    error
+	code   codes.Code
+	reason chordpb.ErrorReason
+}{
+	{ErrRateLimited, codes.ResourceExhausted, chordpb.ErrorReason_ERROR_REASON_RATE_LIMITED},
+	{ErrTooLarge, codes.ResourceExhausted, chordpb.ErrorReason_ERROR_REASON_TOO_LARGE},
+	{ErrQuotaExceeded, codes.ResourceExhausted, chordpb.ErrorReason_ERROR_REASON_QUOTA_EXCEEDED},
+	{ErrIdentity, codes.PermissionDenied, chordpb.ErrorReason_ERROR_REASON_IDENTITY_MISMATCH},
+	{ErrPermission, codes.PermissionDenied, chordpb.ErrorReason_ERROR_REASON_PERMISSION_DENIED},
+	{ErrNotFound, codes.NotFound, chordpb.ErrorReason_ERROR_REASON_NOT_FOUND},
+	{ErrInvalidKey, codes.InvalidArgument, chordpb.ErrorReason_ERROR_REASON_INVALID_KEY},
+	{ErrChecksum, codes.DataLoss, chordpb.ErrorReason_ERROR_REASON_CHECKSUM_MISMATCH},
+	{ErrNotOwner, codes.FailedPrecondition, chordpb.ErrorReason_ERROR_REASON_NOT_OWNER},
+	{ErrStale, codes.Aborted, chordpb.ErrorReason_ERROR_REASON_STALE},
+}
+
+// Returns the gRPC status of an error returned by a method of the node.
+func rpcError(err error) error {
+	for _, e := range rpcErrors {
+		if errors.Is(err, e.err) {
+			st, detailErr := status.New(e.code, err.Error()).WithDetails(&chordpb.ErrorDetail{Reason: e.reason})
+			if detailErr != nil {
+				return status.Error(e.code, err.Error())
+			}
+			return st.Err()
+		}
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// An error reported by another node. It keeps the message of the remote error and unwraps to the
+// error of its reason, so it can be checked with errors.Is.
+type remoteError struct {
+	status  error
+	message string
+}
+
+func (e *remoteError) Error() string { return e.message }
+func (e *remoteError) Unwrap() error { return e.status }
+
+// Returns the error of the node behind the gRPC status returned by another node, or the error itself
+// if the status carries no reason.
+func fromRPCError(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	for _, detail := range st.Details() {
+		if detail, ok := detail.(*chordpb.ErrorDetail); ok {
+			for _, e := range rpcErrors {
+				if e.reason == detail.GetReason() {
+					return &remoteError{status: e.err, message: st.Message()}
+				}
+			}
+		}
+	}
+	return err
+}
+
+// Checks that the calling node connected over TLS. The contents and metadata of objects only travel
+// over TLS, also without a cluster CA.
+func requireTLS(ctx context.Context) error {
+	if p, ok := peer.FromContext(ctx); ok {
+		if _, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: file transfers need TLS", ErrPermission)
+}
+
+// Checks that the caller may look up another key or object. Lookups of ring peers are not counted,
+// they maintain the ring, forward lookups of clients and read the versions of the objects they store.
+func (s *rpcServer) allowLookup(ctx context.Context) error {
+	host := peerAddress(ctx)
+	if s.node.isRingPeer(host, peerCertificate(ctx)) {
+		return nil
+	}
+	return s.node.allowLookup(host)
+}
+
+// Returns the host the calling node connected from.
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return peerHost(p.Addr.String())
+}
+
+// Returns the certificate the calling node connected with, nil without a cluster CA.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return info.State.PeerCertificates[0]
+}
+
+// Returns the principal of the calling node, the subject of the certificate it connected with, which
+// the cluster CA verified. Empty without a cluster CA.
+func rpcPrincipal(ctx context.Context) string {
+	cert := peerCertificate(ctx)
+	if cert == nil || clusterCA == nil {
+		return ""
+	}
+	return cert.Subject.String()
+}
+
+// Connections to other nodes, reused across calls. A connection is dropped when the node becomes
+// unavailable, so that a restarted node is dialed again right away.
+var connections = struct {
+	sync.Mutex
+	conns map[string]*grpc.ClientConn
+}{conns: make(map[string]*grpc.ClientConn)}
+
+// Returns a client for the RPC methods of a node, over mutual TLS in cluster CA mode.
+func dialRPC(address string) (chordpb.NodeClient, error) {
+	return dialNode(address, address, func() (credentials.TransportCredentials, error) {
+		if clusterCA == nil {
+			return insecure.NewCredentials(), nil
+		}
+		config, err := clientTLSConfig(NodeRef{Address: address})
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewTLS(config), nil
+	})
+}
+
+// Returns a client for the file transfers of a node on its TLS address, and the key its connection
+// is cached under. Without a cluster CA the connection is pinned to the certificate of nodeRef, so a
+// node with a new certificate gets a new connection.
+func dialTransfer(nodeRef NodeRef) (chordpb.NodeClient, string, error) {
+	key := "tls " + nodeRef.TLSAddress + " " + checksum(nodeRef.PublicKey)
+	client, err := dialNode(key, nodeRef.TLSAddress, func() (credentials.TransportCredentials, error) {
+		config, err := clientTLSConfig(nodeRef)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewTLS(config), nil
+	})
+	return client, key, err
+}
+
+// Returns a client for a node using the connection cached under key, dialing address with the given
+// credentials if there is none.
+func dialNode(key string, address string, creds func() (credentials.TransportCredentials, error)) (chordpb.NodeClient, error) {
+	if address == "" {
+		return nil, errors.New("no address")
+	}
+	connections.Lock()
+	defer connections.Unlock()
+	if conn, ok := connections.conns[key]; ok {
+		return chordpb.NewNodeClient(conn), nil
+	}
+
+	transportCreds, err := creds()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient("passthrough:///"+address, grpc.WithTransportCredentials(transportCreds))
+	if err != nil {
+		return nil, err
+	}
+	connections.conns[key] = conn
+	return chordpb.NewNodeClient(conn), nil
+}
+
+// Drops the connection cached under key.
+func forgetConnection(key string) {
+	connections.Lock()
+	defer connections.Unlock()
+	if conn, ok := connections.conns[key]; ok {
+		conn.Close()
+		delete(connections.conns, key)
+	}
+}
+
+// remoteNode calls the RPC methods of another node, with the same arguments and replies as the
+// methods of the node itself.
+type remoteNode struct {
+	address string
+}
+
+func remote(address string) remoteNode {
+	return remoteNode{address: address}
+}
+
+// Calls a method of the node with a deadline.
+func (r remoteNode) call(method func(ctx context.Context, client chordpb.NodeClient) error) error {
+	client, err := dialRPC(r.address)
 	if err != nil {
 		return fmt.Errorf("Failed to dial: %v", err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
 
-	err = conn.Call(method, args, reply)
+	err = method(ctx, client)
+	if status.Code(err) == codes.Unavailable {
+		forgetConnection(r.address)
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to call: %v", err)
 	}
-	conn.Close()
 	return nil
 }
+
+func (r remoteNode) FindSuccessor(args *FindSuccessorArgs, reply *FindSuccessorReply) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.FindSuccessor(ctx, &chordpb.FindSuccessorRequest{Key: args.Key})
+		if err == nil {
+			reply.Successor = fromProtoNodeRef(resp.GetSuccessor())
+		}
+		return err
+	})
+}
+
+func (r remoteNode) ClosestPrecedingNode(args *ClosestPrecedingNodeArgs, reply *ClosestPrecedingNodeReply) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.ClosestPrecedingNode(ctx, &chordpb.ClosestPrecedingNodeRequest{Key: args.Key})
+		if err == nil {
+			reply.Node = fromProtoNodeRef(resp.GetNode())
+		}
+		return err
+	})
+}
+
+func (r remoteNode) Notify(args *NotifyArgs, reply *Empty) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		_, err := client.Notify(ctx, &chordpb.NotifyRequest{Node: toProtoNodeRef(args.Key)})
+		return err
+	})
+}
+
+func (r remoteNode) GetPredecessor(args *Empty, reply *GetPredecessorReply) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.GetPredecessor(ctx, &chordpb.GetPredecessorRequest{})
+		if err == nil {
+			reply.Predecessor = fromProtoNodeRef(resp.GetPredecessor())
+		}
+		return err
+	})
+}
+
+func (r remoteNode) GetSuccessorList(args *GetSuccessorlistArgs, reply *GetSuccessorlistReply) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.GetSuccessorList(ctx, &chordpb.GetSuccessorListRequest{})
+		if err == nil {
+			reply.Successors = fromProtoNodeRefs(resp.GetSuccessors())
+			reply.Node = fromProtoNodeRef(resp.GetNode())
+		}
+		return err
+	})
+}
+
+func (r remoteNode) Ping(args *Empty, reply *Empty) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		_, err := client.Ping(ctx, &chordpb.PingRequest{})
+		return err
+	})
+}
+
+func (r remoteNode) ListKeys(args *ListKeysArgs, reply *ListKeysReply) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		stream, err := client.ListKeys(ctx, &chordpb.ListKeysRequest{OwnedOnly: args.OwnedOnly})
+		if err != nil {
+			return err
+		}
+		for {
+			entry, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			reply.Entries = append(reply.Entries, fromProtoObjectInfo(entry))
+		}
+	})
+}
+
+func (r remoteNode) GetDigest(args *Empty, reply *GetDigestReply) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.GetDigest(ctx, &chordpb.GetDigestRequest{})
+		if err == nil {
+			reply.Digest = resp.GetDigest()
+			reply.Count = int(resp.GetCount())
+		}
+		return err
+	})
+}
+
+func (r remoteNode) GetCapacity(args *Empty, reply *Usage) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.GetCapacity(ctx, &chordpb.GetCapacityRequest{})
+		if err == nil {
+			*reply = Usage{UsedBytes: resp.GetUsedBytes(), UsedObjects: int(resp.GetUsedObjects()), QuotaBytes: resp.GetQuotaBytes(), QuotaObjects: int(resp.GetQuotaObjects())}
+		}
+		return err
+	})
+}
+
+func (r remoteNode) GetRejections(args *Empty, reply *Rejections) error {
+	return r.call(func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.GetRejections(ctx, &chordpb.GetRejectionsRequest{})
+		if err == nil {
+			*reply = Rejections{Connections: resp.GetConnections(), Lookups: resp.GetLookups(), Stores: resp.GetStores(), Oversized: resp.GetOversized()}
+		}
+		return err
+	})
+}
@@ -0,0 +1,79 @@
+package chord
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// The routing state of a node that is checkpointed to disk so that it can reconnect after a restart.
+type nodeState struct {
+	Address     string
+	Successors  []NodeRef
+	Predecessor NodeRef
+	FingerTable []NodeRef
+}
+
+// Writes the routing state of the node to StatePath. The state is written to a temporary file which
+// is synced and then renamed, so that a crash during the write never leaves a truncated checkpoint.
+func (node *Node) Checkpoint() {
+	if node.StatePath == "" {
+		return
+	}
+
+	state := nodeState{Address: node.Address, Predecessor: node.Predecessor}
+	state.Successors = append(state.Successors, node.Successors...)
+	state.FingerTable = append(state.FingerTable, node.FingerTable...)
+
+	// Nothing worth saving while the node is alone, and overwriting would lose the previous peers
+	if len(state.peers()) == 0 {
+		return
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Println("Failed to encode node state: ", err)
+		return
+	}
+	err = writeAtomic(node.StatePath, func(file *os.File) error {
+		_, err := file.Write(data)
+		return err
+	})
+	if err != nil {
+		log.Println("Failed to write node state: ", err)
+	}
+}
+
+// Reads the checkpointed routing state and returns the addresses of the previously known peers,
+// successors first, so that they can be tried before the bootstrap addresses.
+func (node *Node) LoadState() ([]string, error) {
+	data, err := os.ReadFile(node.StatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var state nodeState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode node state: %w", err)
+	}
+	if state.Address != node.Address {
+		return nil, fmt.Errorf("node state belongs to %s, not %s", state.Address, node.Address)
+	}
+	return state.peers(), nil
+}
+
+// Returns the distinct addresses of other nodes in the state, successors first.
+func (state *nodeState) peers() []string {
+	var peers []string
+	seen := map[string]bool{"": true, state.Address: true}
+	refs := append(append(append([]NodeRef{}, state.Successors...), state.Predecessor), state.FingerTable...)
+	for _, ref := range refs {
+		if !seen[ref.Address] {
+			seen[ref.Address] = true
+			peers = append(peers, ref.Address)
+		}
+	}
+	return peers
+}
@@ -0,0 +1,189 @@
+package chord
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("key not found")
+	ErrInvalidKey    = errors.New("invalid key")
+	ErrChecksum      = errors.New("checksum mismatch")
+	ErrNotOwner      = errors.New("not owner")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrStale         = errors.New("stale version")
+)
+
+const maxKeyLength = 1024 // Maximum length of a key in bytes
+
+// ObjectInfo is the metadata of an object in a store. It is stored and transferred together with the object.
+type ObjectInfo struct {
+	Key         string        // Key is the key the object is stored under
+	Name        string        // Name is the original file name of the object
+	Size        int64         // Size is the size of the object in bytes
+	Checksum    string        // Checksum is the hex encoded SHA-256 of the object contents
+	ContentType string        // ContentType is the MIME type of the object contents
+	Created     time.Time     // Created is the time the first version of the object was stored
+	Modified    time.Time     // Modified is the time this version of the object was stored
+	Uploader    string        // Uploader is the address of the node that stored this version
+	Version     uint64        // Version is incremented every time the object is written
+	Vector      VersionVector // Vector is the version vector of this version
+	Siblings    []Sibling     // Siblings are the versions written concurrently with this version
+	Manifest    bool          // Manifest is set if the object is the manifest of a file stored in chunks or fragments
+	Fragment    bool          // Fragment is set if the object is an erasure coded fragment placed on a specific node
+	Expires     time.Time     // Expires is the time the object expires and is deleted, zero if it never expires
+	Deleted     bool          // Deleted is set if the object is the tombstone of an expired object
+	Encryption  *Encryption   // Encryption describes how the client encrypted the contents, nil if they are not encrypted
+	ACL         *ACL          // ACL controls which nodes may read and write the object, nil if every node may
+	References  []string      // References are the keys of the files whose manifests list the chunk, empty if unknown
+	Replicas    int           // Replicas is the number of copies the writer placed of the object (N), 0 if unknown
+}
+
+// Store is a storage backend for the objects a node is responsible for.
+type Store interface {
+	// Put stores the contents of r and its metadata under info.Key, replacing any previous object.
+	// The size and checksum of the metadata are set from the contents.
+	Put(info ObjectInfo, r io.Reader) (ObjectInfo, error)
+	// Get opens the object stored under key. The caller must close the reader.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key.
+	Delete(key string) error
+	// List returns the keys of all stored objects.
+	List() ([]string, error)
+	// Stat describes the object stored under key.
+	Stat(key string) (ObjectInfo, error)
+}
+
+// Checks that a key can be stored. Keys are arbitrary strings, but empty or over-long keys and keys
+// that look like an attempt to escape a directory, such as absolute paths or paths with .. segments,
+// are rejected.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("%w: key is %d bytes, the limit is %d", ErrInvalidKey, len(key), maxKeyLength)
+	}
+	if strings.ContainsRune(key, 0) {
+		return fmt.Errorf("%w: key contains a NUL byte", ErrInvalidKey)
+	}
+	if strings.HasPrefix(key, "/") || strings.HasPrefix(key, "\\") || filepath.VolumeName(key) != "" {
+		return fmt.Errorf("%w: absolute path %q", ErrInvalidKey, key)
+	}
+	for _, segment := range strings.FieldsFunc(key, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return fmt.Errorf("%w: path traversal in %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+// A reader that hashes everything read through it and returns ErrChecksum instead of io.EOF if the
+// SHA-256 of the contents does not match the expected checksum.
+type checksumReader struct {
+	r        io.Reader
+	h        hash.Hash
+	checksum string
+}
+
+func NewChecksumReader(r io.Reader, checksum string) io.Reader {
+	return &checksumReader{r: r, h: sha256.New(), checksum: checksum}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(c.h.Sum(nil)) != c.checksum {
+		return n, ErrChecksum
+	}
+	return n, err
+}
+
+// MemStore is a Store that keeps objects in memory, useful for tests.
+type MemStore struct {
+	mu      sync.RWMutex
+	objects map[string]memObject
+}
+
+type memObject struct {
+	info ObjectInfo
+	data []byte
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{objects: make(map[string]memObject)}
+}
+
+func (s *MemStore) Put(info ObjectInfo, r io.Reader) (ObjectInfo, error) {
+	err := ValidateKey(info.Key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info.Size = int64(len(data))
+	info.Checksum = checksum(data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[info.Key] = memObject{info: info, data: data}
+	return info, nil
+}
+
+func (s *MemStore) Get(key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(NewChecksumReader(bytes.NewReader(object.data), object.info.Checksum)), nil
+}
+
+func (s *MemStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *MemStore) Stat(key string) (ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return object.info, nil
+}
+
+// Returns the hex encoded SHA-256 of data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,245 @@
+package chord
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A store under test, with a function that corrupts the stored contents of a key.
+type testStore struct {
+	name    string
+	store   Store
+	corrupt func(t *testing.T, key string)
+}
+
+func testStores(t *testing.T) []testStore {
+	fsStore := NewFSStore(t.TempDir())
+	memStore := NewMemStore()
+	return []testStore{
+		{"FSStore", fsStore, func(t *testing.T, key string) {
+			err := os.WriteFile(fsStore.path(key), []byte("tampered"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"MemStore", memStore, func(t *testing.T, key string) {
+			memStore.mu.Lock()
+			defer memStore.mu.Unlock()
+			object := memStore.objects[key]
+			object.data = []byte("tampered")
+			memStore.objects[key] = object
+		}},
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for _, ts := range testStores(t) {
+		t.Run(ts.name, func(t *testing.T) {
+			data := []byte("hello chord")
+			info, err := ts.store.Put(ObjectInfo{Key: "dir/hello.txt", Name: "hello.txt"}, bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != int64(len(data)) || info.Checksum != checksum(data) {
+				t.Fatalf("Put() = size %d checksum %s, want %d %s", info.Size, info.Checksum, len(data), checksum(data))
+			}
+
+			stat, err := ts.store.Stat("dir/hello.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Key != "dir/hello.txt" || stat.Name != "hello.txt" || stat.Checksum != info.Checksum {
+				t.Fatalf("Stat() = %+v, want %+v", stat, info)
+			}
+
+			reader, err := ts.store.Get("dir/hello.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("Get() = %q, %v, want %q", got, err, data)
+			}
+
+			keys, err := ts.store.List()
+			if err != nil || len(keys) != 1 || keys[0] != "dir/hello.txt" {
+				t.Fatalf("List() = %v, %v, want [dir/hello.txt]", keys, err)
+			}
+
+			err = ts.store.Delete("dir/hello.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ts.store.Get("dir/hello.txt")
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get() after Delete() error = %v, want ErrNotFound", err)
+			}
+			_, err = ts.store.Stat("dir/hello.txt")
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Stat() after Delete() error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreChecksum(t *testing.T) {
+	for _, ts := range testStores(t) {
+		t.Run(ts.name, func(t *testing.T) {
+			_, err := ts.store.Put(ObjectInfo{Key: "hello.txt"}, bytes.NewReader([]byte("hello chord")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.corrupt(t, "hello.txt")
+
+			reader, err := ts.store.Get("hello.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			_, err = io.ReadAll(reader)
+			if !errors.Is(err, ErrChecksum) {
+				t.Fatalf("reading corrupt contents error = %v, want ErrChecksum", err)
+			}
+		})
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"hello.txt", true},
+		{"dir/sub/hello.txt", true},
+		{"..hidden", true},
+		{"a..b/c", true},
+		{strings.Repeat("k", maxKeyLength), true},
+		{"", false},
+		{"../x", false},
+		{"dir/../../x", false},
+		{"dir\\..\\x", false},
+		{"..", false},
+		{"/etc/passwd", false},
+		{"\\server\\share", false},
+		{"hello\x00.txt", false},
+		{strings.Repeat("k", maxKeyLength+1), false},
+	}
+	for _, test := range tests {
+		err := ValidateKey(test.key)
+		if test.valid && err != nil {
+			t.Errorf("ValidateKey(%.40q) = %v, want nil", test.key, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ValidateKey(%.40q) = %v, want ErrInvalidKey", test.key, err)
+		}
+	}
+}
+
+func TestFSStorePathStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	store := NewFSStore(root)
+	keys := []string{"hello.txt", "../x", "../../etc/passwd", "/etc/passwd", "dir/../../x", "\\..\\x", "hello\x00.txt", ".", ""}
+	for _, key := range keys {
+		path := store.path(key)
+		if filepath.Dir(path) != root {
+			t.Errorf("path(%q) = %s, want a file directly in %s", key, path, root)
+		}
+	}
+
+	for _, key := range []string{"../x", "/etc/passwd", "hello\x00.txt", ""} {
+		_, err := store.Put(ObjectInfo{Key: key}, strings.NewReader("data"))
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("root contains %d entries after rejected puts, %v", len(entries), err)
+	}
+	_, err = os.Stat(filepath.Join(filepath.Dir(root), "x"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("file written outside the root: %v", err)
+	}
+}
+
+func TestFSStoreMigrate(t *testing.T) {
+	root := t.TempDir()
+	legacy := map[string]string{"hello.txt": "hello", "dir/sub/notes.txt": "notes"}
+	for key, data := range legacy {
+		path := filepath.Join(root, filepath.FromSlash(key))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(data), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := NewFSStore(root)
+	_, err := store.Put(ObjectInfo{Key: "current.txt"}, strings.NewReader("current"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := store.Migrate()
+	if err != nil || migrated != len(legacy) {
+		t.Fatalf("Migrate() = %d, %v, want %d", migrated, err, len(legacy))
+	}
+	keys, err := store.List()
+	if err != nil || strings.Join(keys, ",") != "current.txt,dir/sub/notes.txt,hello.txt" {
+		t.Fatalf("List() = %v, %v", keys, err)
+	}
+	for key, data := range legacy {
+		reader, err := store.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil || string(got) != data {
+			t.Fatalf("Get(%q) = %q, %v, want %q", key, got, err, data)
+		}
+	}
+	_, err = os.Stat(filepath.Join(root, "dir"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("legacy directory still exists: %v", err)
+	}
+
+	migrated, err = store.Migrate()
+	if err != nil || migrated != 0 {
+		t.Fatalf("second Migrate() = %d, %v, want 0", migrated, err)
+	}
+}
+
+func TestBuildIndexSkipsUnreadableMetadata(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	for _, key := range []string{"a.txt", "b.txt", "c.txt"} {
+		_, err := store.Put(ObjectInfo{Key: key}, strings.NewReader(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(store.path("b.txt")+metaSuffix, []byte("{truncated"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := &Node{Storage: store}
+	err = node.BuildIndex()
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	var keys []string
+	for _, entry := range node.Index.List() {
+		keys = append(keys, entry.Key)
+	}
+	if strings.Join(keys, ",") != "a.txt,c.txt" {
+		t.Fatalf("indexed keys = %v, want the keys with readable metadata", keys)
+	}
+}
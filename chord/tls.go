@@ -1,119 +1,428 @@
 package chord
 
 import (
+	"bytes"
+	"chord/chord/chordpb"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"os"
-	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// Establishes a secure channel for sending files between nodes using TLS.
-func (node *Node) TLSListen() {
-	cer, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Println("Loaded TLS keypair: ")
-	config := &tls.Config{Certificates: []tls.Certificate{cer}}
+const (
+	transferTimeout   = 10 * time.Minute // Deadline of a file transfer to or from another node
+	transferChunkSize = 64 << 10         // Size of the parts of the contents sent in one message
+)
 
-	ln, err := tls.Listen("tcp", node.TLSAddress, config)
+// Serves the RPC methods of the node over TLS on the TLS port, where other nodes transfer files. In
+// cluster CA mode only nodes with a certificate signed by the CA can connect. At most MaxConnections
+// connections are served at once.
+func (node *Node) serveTLS(server *grpc.Server) {
+	listener, err := net.Listen("tcp", node.TLSAddress)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer ln.Close()
 	log.Println("TLS Listening on", node.TLSAddress)
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		log.Println("Accepted TLS connection")
-		go node.handleConnection(conn)
+	err = server.Serve(tls.NewListener(node.limitListener(listener), serverTLSConfig()))
+	if err != nil {
+		log.Fatalf("Failed to serve TLS: %v", err)
 	}
 }
 
-// Reads from the connection and writes the file to the node's storage.
-func (node *Node) handleConnection(conn net.Conn) {
-	defer conn.Close()
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
+// Stores the object sent by another node. The metadata comes first, followed by the contents.
+// Stores are refused if the calling node exceeds its rate or the object exceeds MaxRequestSize.
+func (s *rpcServer) Put(stream chordpb.Node_PutServer) error {
+	ctx := stream.Context()
+	err := requireTLS(ctx)
 	if err != nil {
-		log.Println(err)
-		return
+		return rpcError(err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.GetInfo() == nil {
+		return status.Error(codes.InvalidArgument, "the metadata of the object must be sent first")
 	}
 
-	data := buffer[:n]
-	fileName := string(data[:strings.Index(string(data), "\n")])
-	data = data[strings.Index(string(data), "\n")+1:]
-	file, err := os.Create(node.StoragePath + "/" + fileName)
+	info := fromProtoObjectInfo(first.GetInfo())
+	err = s.node.allowStore(peerAddress(ctx))
+	if err == nil && info.Size < 0 {
+		err = fmt.Errorf("invalid size %d of %s", info.Size, info.Key)
+	}
+	if err == nil {
+		err = s.node.checkSize(info.Key, info.Size)
+	}
+	if err == nil {
+		contents := &streamReader{recv: func() ([]byte, error) {
+			req, err := stream.Recv()
+			if err == nil && req.GetInfo() != nil {
+				err = errors.New("the metadata of the object was sent twice")
+			}
+			return req.GetData(), err
+		}}
+		info, err = s.node.handlePut(info, contents, rpcPrincipal(ctx))
+	}
 	if err != nil {
-		fmt.Println("Failed to create file: ", err)
+		log.Println("Failed to store file: ", err)
+		return rpcError(err)
+	}
+	return stream.SendAndClose(&chordpb.PutResponse{Info: toProtoObjectInfo(info)})
+}
+
+// Sends an object stored on the node to a node that may read it: the metadata followed by the contents.
+func (s *rpcServer) Get(req *chordpb.GetRequest, stream chordpb.Node_GetServer) error {
+	ctx := stream.Context()
+	err := requireTLS(ctx)
+	if err == nil {
+		err = s.allowLookup(ctx)
+	}
+	if err != nil {
+		return rpcError(err)
+	}
+	file, err := s.node.Storage.Get(req.GetKey())
+	if err != nil {
+		return rpcError(err)
 	}
 	defer file.Close()
+	info, err := s.node.Storage.Stat(req.GetKey())
+	if err == nil && !info.ACL.CanRead(rpcPrincipal(ctx)) {
+		err = fmt.Errorf("%w: %s may not read %s", ErrPermission, rpcPrincipal(ctx), req.GetKey())
+	}
+	if err != nil {
+		return rpcError(err)
+	}
+
+	err = stream.Send(&chordpb.GetResponse{Payload: &chordpb.GetResponse_Info{Info: toProtoObjectInfo(info)}})
+	buf := make([]byte, transferChunkSize)
+	for err == nil {
+		var n int
+		n, err = io.ReadFull(file, buf)
+		if n > 0 {
+			sendErr := stream.Send(&chordpb.GetResponse{Payload: &chordpb.GetResponse_Data{Data: buf[:n]}})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+	}
+	if errors.Is(err, ErrChecksum) {
+		s.node.dropCorrupt(req.GetKey())
+		return rpcError(err)
+	}
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		log.Println("Failed to send file: ", err)
+		return rpcError(err)
+	}
+	return nil
+}
 
-	_, err = file.Write(data)
+// Sends the metadata of an object stored on the node to a node that may read it.
+func (s *rpcServer) Stat(ctx context.Context, req *chordpb.StatRequest) (*chordpb.ObjectInfo, error) {
+	err := requireTLS(ctx)
+	if err == nil {
+		err = s.allowLookup(ctx)
+	}
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	info, err := s.node.Storage.Stat(req.GetKey())
+	if err == nil && !info.ACL.CanStat(rpcPrincipal(ctx)) {
+		err = fmt.Errorf("%w: %s may not read %s", ErrPermission, rpcPrincipal(ctx), req.GetKey())
+	}
 	if err != nil {
-		fmt.Println("Failed to write to file: ", err)
+		return nil, rpcError(err)
 	}
+	return toProtoObjectInfo(info), nil
 }
 
-// Sends data file data to a node using TLS.
-func TLSSend(nodeRef NodeRef, fileName string, data []byte) {
-	cer, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
+// Replaces an object stored on the node with a tombstone, if the calling node may write it.
+func (s *rpcServer) Delete(ctx context.Context, req *chordpb.DeleteRequest) (*chordpb.ObjectInfo, error) {
+	err := requireTLS(ctx)
+	if err == nil {
+		err = s.node.allowStore(peerAddress(ctx))
+	}
+	if err == nil {
+		var info ObjectInfo
+		info, err = s.node.handleDelete(req.GetKey(), req.GetUploader(), rpcPrincipal(ctx))
+		if err == nil {
+			return toProtoObjectInfo(info), nil
+		}
+	}
+	log.Println("Failed to delete file: ", err)
+	return nil, rpcError(err)
+}
+
+// Writes an object sent by another node to the node's storage. If the key is already stored, the
+// version vectors decide whether the incoming version replaces it, is kept as a concurrent sibling or
+// is dropped as stale, which is reported with ErrStale. The calling node must be allowed to write the
+// object by its ACL.
+func (node *Node) handlePut(incoming ObjectInfo, reader io.Reader, principal string) (ObjectInfo, error) {
+	// Fragments are placed on specific nodes rather than on the successors of their key
+	if !incoming.Fragment && !node.Owns(incoming) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotOwner, incoming.Key)
+	}
+
+	node.writeLock.Lock()
+	defer node.writeLock.Unlock()
+
+	var current *ObjectInfo
+	if stored, err := node.Storage.Stat(incoming.Key); err == nil {
+		current = &stored
+	}
+	err := authorizeWrite(principal, current, incoming)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, action := incoming, storeIncoming
+	if current != nil {
+		info, action = resolveWrite(*current, incoming)
+	}
+
+	switch action {
+	case dropWrite:
+		if incoming.Vector.Compare(info.Vector) == Equal {
+			// The node already stores this version, so the write is acknowledged
+			return info, nil
+		}
+		log.Printf("Dropped stale write of %s %s\n", incoming.Key, incoming.Vector)
+		return ObjectInfo{}, fmt.Errorf("%w: %s %s is older than the stored %s", ErrStale, incoming.Key, incoming.Vector, info.Vector)
+	case updateStored:
+		info, err = node.updateInfo(info)
+	case storeIncoming:
+		err = node.checkQuota(info.Key, incoming.Size)
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		data := NewChecksumReader(io.LimitReader(reader, incoming.Size), incoming.Checksum)
+		info, err = node.Storage.Put(info, data)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if len(info.Siblings) > 0 {
+		log.Printf("Stored %s with %d concurrent siblings\n", info.Key, len(info.Siblings))
+	}
+	node.Index.Put(info)
+	return info, nil
+}
 
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(nodeRef.PublicKey)
-	config := &tls.Config{Certificates: []tls.Certificate{cer}, RootCAs: caCertPool}
+// Removes the stored copy of an object whose contents did not match their checksum, so that it is
+// repaired from another replica. A write may have replaced the object while it was read, and the
+// metadata and contents of the old and new version may have been mixed up, so the copy is only
+// removed if it is still corrupt once writes are held off.
+func (node *Node) dropCorrupt(key string) {
+	node.writeLock.Lock()
+	defer node.writeLock.Unlock()
 
-	conn, err := tls.Dial("tcp", nodeRef.TLSAddress, config)
+	file, err := node.Storage.Get(key)
 	if err != nil {
-		fmt.Println("TLS Dial error: ", err)
 		return
 	}
-	defer conn.Close()
+	_, err = io.Copy(io.Discard, file)
+	file.Close()
+	if !errors.Is(err, ErrChecksum) {
+		return
+	}
+	log.Printf("Stored copy of %s is corrupt, removing it\n", key)
+	node.Storage.Delete(key)
+	node.Index.Remove(key)
+}
 
-	header := []byte(fileName + "\n")
-	data = append(header, data...)
-	_, err = conn.Write(data)
+// Replaces the metadata of a stored object, keeping its contents.
+func (node *Node) updateInfo(info ObjectInfo) (ObjectInfo, error) {
+	file, err := node.Storage.Get(info.Key)
 	if err != nil {
-		fmt.Println("TLS Write error: ", err)
+		return ObjectInfo{}, err
 	}
+	defer file.Close()
+	return node.Storage.Put(info, file)
 }
 
-// Gets a file from a node using TLS.
-func TLSGet(nodeRef NodeRef, fileName string) ([]byte, error) {
-	cer, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
+// Replaces an object stored on the node with a tombstone written by uploader, the address of the
+// deleting node. The calling node must be allowed to write the object by its ACL.
+func (node *Node) handleDelete(key string, uploader string, principal string) (ObjectInfo, error) {
+	node.writeLock.Lock()
+	defer node.writeLock.Unlock()
 
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(nodeRef.PublicKey)
-	config := &tls.Config{Certificates: []tls.Certificate{cer}, RootCAs: caCertPool}
+	stored, err := node.Storage.Stat(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if !stored.Fragment && !node.Owns(stored) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotOwner, key)
+	}
+	if stored.Deleted {
+		return stored, nil
+	}
+	if uploader == "" {
+		uploader = node.Address
+	}
+	info := stored.deletedBy(uploader)
+	info.Version = stored.Version + 1
+	info.Vector = stored.CausalVector().Increment(uploader)
+	err = authorizeWrite(principal, &stored, info)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err = node.Storage.Put(info, bytes.NewReader(nil))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	node.Index.Put(info)
+	return info, nil
+}
 
-	conn, err := tls.Dial("tcp", nodeRef.TLSAddress, config)
+// streamReader reads the contents of an object from the messages of a stream.
+type streamReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Calls a data operation of a node on its TLS address, verifying the node's certificate against the
+// cluster CA or, without one, against the certificate the node advertised. Errors reported by the
+// node are returned as the errors of the node, so they can be checked with errors.Is.
+func transfer(nodeRef NodeRef, method func(ctx context.Context, client chordpb.NodeClient) error) error {
+	client, key, err := dialTransfer(nodeRef)
 	if err != nil {
-		fmt.Printf("TLS Dial to %s failed with error: %v\n", nodeRef.TLSAddress, err)
-		return nil, err
+		return fmt.Errorf("TLS dial error: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transferTimeout)
+	defer cancel()
+
+	err = method(ctx, client)
+	if status.Code(err) == codes.Unavailable {
+		forgetConnection(key)
 	}
-	defer conn.Close()
+	return fromRPCError(err)
+}
+
+// Sends data file data to a node using TLS and waits for the node to acknowledge the write.
+func TLSSend(nodeRef NodeRef, info ObjectInfo, data []byte) error {
+	info.Size = int64(len(data))
+	info.Checksum = checksum(data)
+	return transfer(nodeRef, func(ctx context.Context, client chordpb.NodeClient) error {
+		stream, err := client.Put(ctx)
+		if err != nil {
+			return err
+		}
+		err = stream.Send(&chordpb.PutRequest{Payload: &chordpb.PutRequest_Info{Info: toProtoObjectInfo(info)}})
+		for start := 0; err == nil && start < len(data); start += transferChunkSize {
+			part := data[start:min(start+transferChunkSize, len(data))]
+			err = stream.Send(&chordpb.PutRequest{Payload: &chordpb.PutRequest_Data{Data: part}})
+		}
+		// On io.EOF the node ended the stream, the reason is in the reply
+		if err != nil && err != io.EOF {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	})
+}
 
-	// read the file in node storage
-	file, err := os.Open(fileName)
+// Gets a file and its metadata from a node using TLS. Files larger than maxSize bytes are refused,
+// unless maxSize is 0.
+func TLSGet(nodeRef NodeRef, fileName string, maxSize int64) ([]byte, ObjectInfo, error) {
+	var data []byte
+	var info ObjectInfo
+	err := transfer(nodeRef, func(ctx context.Context, client chordpb.NodeClient) error {
+		stream, err := client.Get(ctx, &chordpb.GetRequest{Key: fileName})
+		if err != nil {
+			return err
+		}
+		first, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if first.GetInfo() == nil {
+			return fmt.Errorf("no metadata sent for %s", fileName)
+		}
+		info = fromProtoObjectInfo(first.GetInfo())
+		contents := &streamReader{recv: func() ([]byte, error) {
+			resp, err := stream.Recv()
+			return resp.GetData(), err
+		}}
+		data, err = readContents(contents, info, maxSize)
+		if err != nil {
+			return err
+		}
+		// The node reports errors it found after sending the contents when it ends the stream
+		_, err = stream.Recv()
+		if err == nil {
+			return fmt.Errorf("more contents sent for %s than its size", fileName)
+		}
+		if err != io.EOF {
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("Failed to open file: %v\n", err)
-		return nil, err
+		return nil, ObjectInfo{}, err
 	}
-	defer file.Close()
+	if checksum(data) != info.Checksum {
+		return nil, ObjectInfo{}, ErrChecksum
+	}
+	return data, info, nil
+}
 
-	// write the file into a byte array
-	data := make([]byte, 1024)
-	_, err = file.Read(data)
+// Reads the contents of an object sent by another node. The size in the metadata comes from that
+// node, so it is checked before it is trusted, and the buffer only grows as the contents arrive.
+func readContents(reader io.Reader, info ObjectInfo, maxSize int64) ([]byte, error) {
+	if info.Size < 0 {
+		return nil, fmt.Errorf("invalid size %d of %s", info.Size, info.Key)
+	}
+	if maxSize > 0 && info.Size > maxSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrTooLarge, info.Key, info.Size, maxSize)
+	}
+	data := new(bytes.Buffer)
+	n, err := data.ReadFrom(io.LimitReader(reader, info.Size))
+	if err == nil && n < info.Size {
+		err = io.ErrUnexpectedEOF
+	}
 	if err != nil {
-		fmt.Printf("Failed to read file: %v\n", err)
 		return nil, err
 	}
+	return data.Bytes(), nil
+}
+
+// Gets the metadata of a file from a node using TLS.
+func TLSStat(nodeRef NodeRef, fileName string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := transfer(nodeRef, func(ctx context.Context, client chordpb.NodeClient) error {
+		resp, err := client.Stat(ctx, &chordpb.StatRequest{Key: fileName})
+		if err == nil {
+			info = fromProtoObjectInfo(resp)
+		}
+		return err
+	})
+	return info, err
+}
 
-	return data, nil
+// Replaces a file stored on a node with a tombstone using TLS, as a deletion by uploader.
+func TLSDelete(nodeRef NodeRef, fileName string, uploader string) error {
+	return transfer(nodeRef, func(ctx context.Context, client chordpb.NodeClient) error {
+		_, err := client.Delete(ctx, &chordpb.DeleteRequest{Key: fileName, Uploader: uploader})
+		return err
+	})
 }
@@ -0,0 +1,203 @@
+package chord
+
+import (
+	"bytes"
+	"chord/chord/chordpb"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadContents(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		size    int64
+		maxSize int64
+		wantErr error
+	}{
+		{"complete", "hello", 5, 0, nil},
+		{"within limit", "hello", 5, 5, nil},
+		{"negative size", "hello", -1, 0, errInvalid},
+		{"above limit", "hello", 5, 4, ErrTooLarge},
+		{"huge size", "hello", 1 << 62, 1 << 20, ErrTooLarge},
+		{"short body", "hel", 5, 0, io.ErrUnexpectedEOF},
+		{"longer body", "hello world", 5, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := readContents(strings.NewReader(test.body), ObjectInfo{Key: "k", Size: test.size}, test.maxSize)
+			switch {
+			case test.wantErr == errInvalid:
+				if err == nil {
+					t.Fatalf("readContents() succeeded, want an error")
+				}
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("readContents() error = %v, want %v", err, test.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("readContents() error = %v", err)
+			case int64(len(data)) != test.size:
+				t.Fatalf("readContents() read %d bytes, want %d", len(data), test.size)
+			}
+		})
+	}
+}
+
+var errInvalid = errors.New("any error")
+
+// Serves the Node service of a node with a generated certificate over TLS, and over plaintext on a
+// second listener. Returns the NodeRef of the node and the address of the plaintext listener.
+func serveTestNode(t *testing.T, node *Node) (NodeRef, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Address = listener.Addr().String()
+
+	dir := t.TempDir()
+	previousCert, previousKey := certFile, keyFile
+	SetCertificate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	t.Cleanup(func() { SetCertificate(previousCert, previousKey) })
+	err = EnsureCertificate(node.Address)
+	if err == nil {
+		_, err = certificates.load(node.Address)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer(grpc.Creds(connCredentials{credentials.NewTLS(serverTLSConfig())}))
+	chordpb.RegisterNodeServer(server, &rpcServer{node: node})
+	go server.Serve(tls.NewListener(listener, serverTLSConfig()))
+	go server.Serve(plaintext)
+	t.Cleanup(server.Stop)
+
+	nodeRef := NodeRef{Address: node.Address, TLSAddress: node.Address, PublicKey: certificates.publicKey()}
+	t.Cleanup(func() {
+		_, key, _ := dialTransfer(nodeRef)
+		forgetConnection(key)
+	})
+	return nodeRef, plaintext.Addr().String()
+}
+
+func TestTransferRoundTrip(t *testing.T) {
+	node := &Node{Storage: NewMemStore(), Index: NewKeyIndex()}
+	nodeRef, _ := serveTestNode(t, node)
+
+	// Larger than one message, so the contents are sent in parts
+	data := bytes.Repeat([]byte("chord"), transferChunkSize)
+	info := ObjectInfo{Key: "file.txt", Vector: VersionVector{}.Increment("writer")}
+	err := TLSSend(nodeRef, info, data)
+	if err != nil {
+		t.Fatalf("TLSSend() error = %v", err)
+	}
+
+	got, gotInfo, err := TLSGet(nodeRef, "file.txt", 0)
+	if err != nil {
+		t.Fatalf("TLSGet() error = %v", err)
+	}
+	if !bytes.Equal(got, data) || gotInfo.Size != int64(len(data)) {
+		t.Fatalf("TLSGet() returned %d bytes of size %d, want %d", len(got), gotInfo.Size, len(data))
+	}
+	_, _, err = TLSGet(nodeRef, "file.txt", int64(len(data)-1))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("TLSGet() above the limit error = %v, want %v", err, ErrTooLarge)
+	}
+
+	err = TLSDelete(nodeRef, "file.txt", "deleter")
+	if err != nil {
+		t.Fatalf("TLSDelete() error = %v", err)
+	}
+	stat, err := TLSStat(nodeRef, "file.txt")
+	if err != nil {
+		t.Fatalf("TLSStat() error = %v", err)
+	}
+	if !stat.Deleted || stat.Uploader != "deleter" || info.Vector.Compare(stat.Vector) != Before {
+		t.Fatalf("TLSStat() after delete = %+v, want a newer tombstone by deleter", stat)
+	}
+
+	// The tombstone replaced the first version, so the replica drops a retry of it
+	err = TLSSend(nodeRef, info, data)
+	if !errors.Is(err, ErrStale) {
+		t.Fatalf("TLSSend() of a replaced version error = %v, want %v", err, ErrStale)
+	}
+
+	// The node refuses the object before it has read the contents, the sender still gets the reason
+	node.MaxRequestSize = 1
+	err = TLSSend(nodeRef, ObjectInfo{Key: "large.txt"}, data)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("TLSSend() above MaxRequestSize error = %v, want %v", err, ErrTooLarge)
+	}
+
+	// Nodes read the stored version before every write, so reads of ring peers are not limited
+	node.LookupRate = 0.001
+	for i := 0; i < 3; i++ {
+		_, err = TLSStat(nodeRef, "file.txt")
+		if err != nil {
+			t.Fatalf("TLSStat() of a ring peer above LookupRate error = %v", err)
+		}
+	}
+
+	_, err = TLSStat(nodeRef, "missing.txt")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("TLSStat() of a missing key error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestTransferNeedsTLS(t *testing.T) {
+	node := &Node{Storage: NewMemStore(), Index: NewKeyIndex()}
+	_, plaintext := serveTestNode(t, node)
+
+	conn, err := grpc.NewClient("passthrough:///"+plaintext, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = chordpb.NewNodeClient(conn).Stat(context.Background(), &chordpb.StatRequest{Key: "file.txt"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Stat() over plaintext error = %v, want PermissionDenied", err)
+	}
+}
+
+func TestDropCorrupt(t *testing.T) {
+	for _, ts := range testStores(t) {
+		t.Run(ts.name, func(t *testing.T) {
+			node := &Node{Storage: ts.store, Index: NewKeyIndex()}
+			info, err := ts.store.Put(ObjectInfo{Key: "k"}, strings.NewReader("contents"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			node.Index.Put(info)
+
+			// A reader that saw a checksum mismatch while a write replaced the object leaves it in place
+			node.dropCorrupt("k")
+			if _, err := ts.store.Stat("k"); err != nil {
+				t.Fatalf("dropCorrupt() removed an intact copy: %v", err)
+			}
+
+			ts.corrupt(t, "k")
+			node.dropCorrupt("k")
+			if _, err := ts.store.Stat("k"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Stat() after dropCorrupt() error = %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package chord
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VersionVector maps the address of every node that wrote a key to the number of writes it made.
+// Comparing the vectors of two versions tells whether one replaced the other or if they were
+// written concurrently.
+type VersionVector map[string]uint64
+
+// Ordering is the result of comparing two version vectors.
+type Ordering int
+
+const (
+	Equal      Ordering = iota // Both vectors describe the same version
+	Before                     // The first version is older than the second
+	After                      // The first version is newer than the second
+	Concurrent                 // The versions were written concurrently
+)
+
+// Sibling describes a version of a key that was written concurrently with the stored version.
+type Sibling struct {
+	Checksum string        // Checksum is the hex encoded SHA-256 of the sibling's contents
+	Size     int64         // Size is the size of the sibling in bytes
+	Modified time.Time     // Modified is the time the sibling was stored
+	Uploader string        // Uploader is the address of the node that stored the sibling
+	Vector   VersionVector // Vector is the version vector of the sibling
+}
+
+// Compares two version vectors.
+func (v VersionVector) Compare(other VersionVector) Ordering {
+	less, greater := false, false
+	for node, n := range v {
+		if n > other[node] {
+			greater = true
+		} else if n < other[node] {
+			less = true
+		}
+	}
+	for node, n := range other {
+		if _, ok := v[node]; !ok && n > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return Concurrent
+	case less:
+		return Before
+	case greater:
+		return After
+	}
+	return Equal
+}
+
+// Returns a vector that has seen every write of both vectors.
+func (v VersionVector) Merge(other VersionVector) VersionVector {
+	merged := make(VersionVector, len(v))
+	for node, n := range v {
+		merged[node] = n
+	}
+	for node, n := range other {
+		if n > merged[node] {
+			merged[node] = n
+		}
+	}
+	return merged
+}
+
+// Returns a copy of the vector with one more write by a node.
+func (v VersionVector) Increment(node string) VersionVector {
+	incremented := v.Merge(nil)
+	incremented[node]++
+	return incremented
+}
+
+func (v VersionVector) String() string {
+	nodes := make([]string, 0, len(v))
+	for node := range v {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	entries := make([]string, len(nodes))
+	for i, node := range nodes {
+		entries[i] = fmt.Sprintf("%s:%d", node, v[node])
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// Returns the version vector that has seen the stored version and all of its siblings. A write
+// with a vector derived from it replaces the stored version and resolves the conflict.
+func (info ObjectInfo) CausalVector() VersionVector {
+	vector := info.Vector.Merge(nil)
+	for _, sibling := range info.Siblings {
+		vector = vector.Merge(sibling.Vector)
+	}
+	return vector
+}
+
+// Describes an object as a sibling of another version.
+func (info ObjectInfo) sibling() Sibling {
+	return Sibling{Checksum: info.Checksum, Size: info.Size, Modified: info.Modified, Uploader: info.Uploader, Vector: info.Vector}
+}
+
+// How an incoming write is applied to the stored version of a key.
+type writeAction int
+
+const (
+	dropWrite     writeAction = iota // The incoming version is stale and is dropped
+	storeIncoming                    // The incoming version is stored
+	updateStored                     // The stored contents are kept with updated metadata
+)
+
+// Decides how an incoming write is applied on top of the stored version of a key and returns the
+// metadata to store. Concurrent versions are resolved the same way on every replica: the version
+// with the latest modification time wins, ties are broken by checksum, and the other versions that
+// have not been replaced are kept as siblings so that reads can report the conflict. Versions with
+// the same vector but different contents are concurrent too: they were written by nodes that each
+// started from a version the other did not see.
+func resolveWrite(stored ObjectInfo, incoming ObjectInfo) (ObjectInfo, writeAction) {
+	ordering := incoming.Vector.Compare(stored.Vector)
+	if ordering == Equal && incoming.Checksum != stored.Checksum {
+		ordering = Concurrent
+	}
+	if ordering == Before || ordering == Equal {
+		return stored, dropWrite
+	}
+	if ordering == Concurrent && (len(stored.References) > 0 || len(incoming.References) > 0) {
+		return mergeChunk(stored, incoming)
+	}
+
+	winner, action := incoming, storeIncoming
+	switch {
+	case ordering == After:
+	case stored.Checksum == incoming.Checksum:
+		// The same contents were written concurrently, so there is nothing to choose between
+		winner, action = stored, updateStored
+		winner.Vector = stored.Vector.Merge(incoming.Vector)
+	case stored.Modified.After(incoming.Modified) || (stored.Modified.Equal(incoming.Modified) && stored.Checksum > incoming.Checksum):
+		winner, action = stored, updateStored
+	}
+
+	versions := append([]Sibling{stored.sibling(), incoming.sibling()}, stored.Siblings...)
+	versions = append(versions, incoming.Siblings...)
+	winner.Siblings = liveSiblings(winner.sibling(), versions)
+	return winner, action
+}
+
+// Merges concurrent versions of a chunk. Files that share a chunk add and remove their references
+// concurrently, and a reference lost to a concurrent write would let a release delete a chunk that is
+// still in use. The merged version has the references of both versions and replaces both, and a chunk
+// released by one version stays stored if the other still references it. A reference can outlive a
+// concurrent release of it, which keeps the chunk stored rather than losing it.
+func mergeChunk(stored ObjectInfo, incoming ObjectInfo) (ObjectInfo, writeAction) {
+	winner, action := stored, updateStored
+	if stored.Deleted && !incoming.Deleted {
+		winner, action = incoming, storeIncoming
+	}
+	winner.Vector = stored.Vector.Merge(incoming.Vector)
+	var references []string
+	seen := make(map[string]bool)
+	for _, ref := range append(slices.Clone(stored.References), incoming.References...) {
+		if !seen[ref] {
+			seen[ref] = true
+			references = append(references, ref)
+		}
+	}
+	sort.Strings(references)
+	winner.References = references
+
+	versions := append(slices.Clone(stored.Siblings), incoming.Siblings...)
+	winner.Siblings = liveSiblings(winner.sibling(), versions)
+	return winner, action
+}
+
+// Returns the versions that are concurrent with the winning version and not replaced by any of the
+// other versions, without duplicates and sorted so that every replica keeps the same list.
+func liveSiblings(winner Sibling, versions []Sibling) []Sibling {
+	var live []Sibling
+	seen := make(map[string]bool)
+	for _, version := range versions {
+		id := version.Checksum + version.Vector.String()
+		if seen[id] || !winner.conflicts(version) {
+			continue
+		}
+		replaced := false
+		for _, other := range versions {
+			if version.Vector.Compare(other.Vector) == Before {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			seen[id] = true
+			live = append(live, version)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].Checksum < live[j].Checksum })
+	return live
+}
+
+// Checks if two versions conflict: their vectors are concurrent, or equal with different contents.
+func (s Sibling) conflicts(other Sibling) bool {
+	switch s.Vector.Compare(other.Vector) {
+	case Concurrent:
+		return true
+	case Equal:
+		return s.Checksum != other.Checksum
+	}
+	return false
+}
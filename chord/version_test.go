@@ -0,0 +1,181 @@
+package chord
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b VersionVector
+		want Ordering
+	}{
+		{"both empty", VersionVector{}, VersionVector{}, Equal},
+		{"equal", VersionVector{"a": 1, "b": 2}, VersionVector{"a": 1, "b": 2}, Equal},
+		{"zero entry", VersionVector{"a": 1, "b": 0}, VersionVector{"a": 1}, Equal},
+		{"before", VersionVector{"a": 1}, VersionVector{"a": 2}, Before},
+		{"before with new writer", VersionVector{"a": 1}, VersionVector{"a": 1, "b": 1}, Before},
+		{"after", VersionVector{"a": 2, "b": 1}, VersionVector{"a": 1, "b": 1}, After},
+		{"concurrent", VersionVector{"a": 2}, VersionVector{"a": 1, "b": 1}, Concurrent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.Compare(test.b); got != test.want {
+				t.Fatalf("Compare() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveWrite(t *testing.T) {
+	early, late := time.Unix(100, 0), time.Unix(200, 0)
+	version := func(sum string, modified time.Time, vector VersionVector) ObjectInfo {
+		return ObjectInfo{Key: "k", Checksum: sum, Modified: modified, Vector: vector}
+	}
+	v1 := VersionVector{"a": 1}
+	v2 := VersionVector{"a": 2}
+	vb := VersionVector{"a": 1, "b": 1}
+
+	tests := []struct {
+		name         string
+		stored       ObjectInfo
+		incoming     ObjectInfo
+		wantAction   writeAction
+		wantChecksum string
+		wantSiblings []string
+	}{
+		{"newer", version("x", early, v1), version("y", late, v2), storeIncoming, "y", nil},
+		{"older", version("y", late, v2), version("x", early, v1), dropWrite, "y", nil},
+		{"same version", version("x", early, v1), version("x", early, v1), dropWrite, "x", nil},
+		{"same vector, other contents, incoming later", version("x", early, v1), version("y", late, v1), storeIncoming, "y", []string{"x"}},
+		{"same vector, other contents, stored later", version("x", late, v1), version("y", early, v1), updateStored, "x", []string{"y"}},
+		{"concurrent, incoming later", version("x", early, v2), version("y", late, vb), storeIncoming, "y", []string{"x"}},
+		{"concurrent, stored later", version("x", late, v2), version("y", early, vb), updateStored, "x", []string{"y"}},
+		{"concurrent, same time", version("x", early, v2), version("y", early, vb), storeIncoming, "y", []string{"x"}},
+		{"concurrent, same contents", version("x", early, v2), version("x", late, vb), updateStored, "x", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, action := resolveWrite(test.stored, test.incoming)
+			if action != test.wantAction || info.Checksum != test.wantChecksum {
+				t.Fatalf("resolveWrite() = %q, action %v, want %q, action %v", info.Checksum, action, test.wantChecksum, test.wantAction)
+			}
+			var siblings []string
+			for _, sibling := range info.Siblings {
+				siblings = append(siblings, sibling.Checksum)
+			}
+			if len(siblings) != len(test.wantSiblings) || (len(siblings) > 0 && siblings[0] != test.wantSiblings[0]) {
+				t.Fatalf("resolveWrite() siblings = %v, want %v", siblings, test.wantSiblings)
+			}
+			// Every replica must arrive at the same version, whatever order the writes came in
+			reversed, _ := resolveWrite(test.incoming, test.stored)
+			if test.wantAction != dropWrite && reversed.Checksum != info.Checksum {
+				t.Fatalf("resolveWrite() in the other order = %q, want %q", reversed.Checksum, info.Checksum)
+			}
+		})
+	}
+}
+
+func TestResolveWriteMergesChunkReferences(t *testing.T) {
+	base := VersionVector{"a": 1}
+	chunk := func(writer string, deleted bool, references ...string) ObjectInfo {
+		info := ObjectInfo{Key: "k", Checksum: "x", Modified: time.Unix(100, 0), Vector: base.Increment(writer), References: references, Deleted: deleted}
+		if deleted {
+			info.Checksum = ""
+			info.Modified = time.Unix(200, 0)
+		}
+		return info
+	}
+
+	tests := []struct {
+		name           string
+		stored         ObjectInfo
+		incoming       ObjectInfo
+		wantDeleted    bool
+		wantReferences string
+	}{
+		{"concurrent stores", chunk("b", false, "one", "two"), chunk("c", false, "one", "three"), false, "one,three,two"},
+		{"store and release", chunk("b", false, "one", "two"), chunk("c", true), false, "one,two"},
+		{"release and store", chunk("c", true), chunk("b", false, "one", "two"), false, "one,two"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, _ := resolveWrite(test.stored, test.incoming)
+			if info.Deleted != test.wantDeleted || strings.Join(info.References, ",") != test.wantReferences {
+				t.Fatalf("resolveWrite() deleted %v, references %v, want deleted %v, references %s", info.Deleted, info.References, test.wantDeleted, test.wantReferences)
+			}
+			if len(info.Siblings) > 0 || info.Vector.Compare(test.stored.Vector) != After || info.Vector.Compare(test.incoming.Vector) != After {
+				t.Fatalf("resolveWrite() = %+v, want a version that replaces both", info)
+			}
+		})
+	}
+}
+
+func TestLiveSiblings(t *testing.T) {
+	winner := Sibling{Checksum: "w", Vector: VersionVector{"a": 2}}
+	tests := []struct {
+		name     string
+		versions []Sibling
+		want     []string
+	}{
+		{"winner only", []Sibling{winner}, nil},
+		{"older version", []Sibling{{Checksum: "o", Vector: VersionVector{"a": 1}}}, nil},
+		{"concurrent", []Sibling{{Checksum: "c", Vector: VersionVector{"a": 1, "b": 1}}}, []string{"c"}},
+		{"same vector, other contents", []Sibling{{Checksum: "e", Vector: VersionVector{"a": 2}}}, []string{"e"}},
+		{"duplicates", []Sibling{{Checksum: "c", Vector: VersionVector{"b": 1}}, {Checksum: "c", Vector: VersionVector{"b": 1}}}, []string{"c"}},
+		{"replaced by another version", []Sibling{{Checksum: "c", Vector: VersionVector{"b": 1}}, {Checksum: "d", Vector: VersionVector{"b": 2}}}, []string{"d"}},
+		{"sorted", []Sibling{{Checksum: "z", Vector: VersionVector{"b": 1}}, {Checksum: "c", Vector: VersionVector{"c": 1}}}, []string{"c", "z"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			live := liveSiblings(winner, test.versions)
+			if len(live) != len(test.want) {
+				t.Fatalf("liveSiblings() = %v, want %v", live, test.want)
+			}
+			for i := range live {
+				if live[i].Checksum != test.want[i] {
+					t.Fatalf("liveSiblings() = %v, want %v", live, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlePutKeepsConflictingContents(t *testing.T) {
+	node := &Node{Storage: NewMemStore(), Index: NewKeyIndex()}
+	vector := VersionVector{"a": 1}
+	put := func(data string, modified time.Time) ObjectInfo {
+		info := ObjectInfo{Key: "k", Size: int64(len(data)), Checksum: checksum([]byte(data)), Modified: modified, Vector: vector}
+		stored, err := node.handlePut(info, bytes.NewReader([]byte(data)), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored
+	}
+	put("first", time.Unix(100, 0))
+	stored := put("second", time.Unix(200, 0))
+	if stored.Checksum != checksum([]byte("second")) || len(stored.Siblings) != 1 || stored.Siblings[0].Checksum != checksum([]byte("first")) {
+		t.Fatalf("handlePut() = %+v, want the second contents with the first as sibling", stored)
+	}
+	// A retry of a stored version is acknowledged, an older version is reported as stale
+	put("second", time.Unix(200, 0))
+	_, err := node.handlePut(ObjectInfo{Key: "k", Vector: VersionVector{}}, bytes.NewReader(nil), "")
+	if !errors.Is(err, ErrStale) {
+		t.Fatalf("handlePut() of an older version error = %v, want %v", err, ErrStale)
+	}
+
+	file, err := node.Storage.Get("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil || string(data) != "second" {
+		t.Fatalf("stored contents = %q, %v, want %q", data, err, "second")
+	}
+}
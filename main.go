@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"chord/chord"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"syscall"
 )
 
 var ipv4Regex = regexp.MustCompile(`(^((25[0-5]|2[0-4]\d|[01]?\d\d?)\.){3}(25[0-5]|2[0-4]\d|[01]?\d\d?)$)|((::0)|(localhost))`)
@@ -22,22 +28,39 @@ func main() {
 	log.SetOutput(f)
 	a := flag.String("a", "", "the chord address")
 	p := flag.Int("p", 0, "the chord port")
-	ja := flag.String("ja", "", "the join address")
-	jp := flag.Int("jp", 0, "the join port")
+	ja := flag.String("ja", "", "the join address, or a comma separated list of join addresses (address or address:port)")
+	jp := flag.Int("jp", 0, "the join port, used for join addresses without a port")
+	seeds := flag.String("seeds", "", "path to a file with one join address (address:port) per line")
 	tcp := flag.Int("tcp", 0, "check predecessor interval")
 	ts := flag.Int("ts", 0, "stabilize interval")
 	tff := flag.Int("ff", 0, "fix fingers interval")
 	r := flag.Int("r", 0, "number of successors maintained")
-	tls := flag.Int("tls", 0, "the tls port")
+	tls := flag.Int("tls", 0, "the tls port, 0 or the chord port to transfer files on the chord port")
+	cp := flag.Int("cp", 5000, "checkpoint interval for the routing state")
+	sw := flag.Int("sw", 10000, "interval at which expired files are deleted")
+	n := flag.Int("n", 3, "number of replicas stored of every file (N)")
+	w := flag.Int("w", 1, "number of replicas that must acknowledge a store (W)")
+	rq := flag.Int("rq", 1, "number of replicas consulted on a lookup (R)")
+	quota := flag.String("quota", "", "maximum total size of the files stored on this node, e.g. 10G")
+	quotaObjects := flag.Int("quota-objects", 0, "maximum number of files stored on this node")
+	maxConns := flag.Int("max-conns", 256, "maximum number of concurrent connections on each of the chord and tls ports, 0 for no limit")
+	lookupRate := flag.Float64("lookup-rate", 0, "lookups per second allowed from every client, 0 for no limit")
+	storeRate := flag.Float64("store-rate", 0, "stores per second allowed from every peer, 0 for no limit")
+	maxSize := flag.String("max-size", "", "maximum size of a file other nodes may store on or send to this node, e.g. 64M")
+	ca := flag.String("ca", "", "path to the cluster CA certificate, enables mutual TLS between nodes")
+	certDir := flag.String("certdir", "", "directory with the certificate and key of the node, generated on first run if missing (default certs-<hash of the address>)")
+	certPath := flag.String("cert", "", "path to the certificate of the node (default cert.pem in -certdir)")
+	keyPath := flag.String("key", "", "path to the private key of the node (default key.pem in -certdir)")
+	keyfile := flag.String("keyfile", "", "path to a file with the 256-bit key files are encrypted with by store -encrypt")
 	flag.Parse()
 
 	// crash if any of the required flags are not set
-	if *a == "" || *p == 0 || *tcp == 0 || *ts == 0 || *tff == 0 || *r == 0 || *tls == 0 || (*ja != "" && *jp == 0) || (*ja == "" && *jp != 0) {
+	if *a == "" || *p == 0 || *tcp == 0 || *ts == 0 || *tff == 0 || *r == 0 || (*ja == "" && *seeds == "" && *jp != 0) {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	if *ts < 1 || *ts > 60000 || *tff < 1 || *tff > 60000 || *tcp < 1 || *tcp > 60000 {
+	if *ts < 1 || *ts > 60000 || *tff < 1 || *tff > 60000 || *tcp < 1 || *tcp > 60000 || *cp < 1 || *cp > 60000 || *sw < 1 || *sw > 60000 {
 		fmt.Println("intervals should be between 1 and 60000")
 		os.Exit(1)
 	}
@@ -52,8 +75,72 @@ func main() {
 		os.Exit(1)
 	}
 
-	if !ipv4Regex.MatchString(*ja) && *ja != "" {
-		fmt.Println("-ja should be a valid IPv4 address")
+	if *n < 1 || *w < 1 || *w > *n || *rq < 1 || *rq > *n {
+		fmt.Println("-w and -rq should be between 1 and -n")
+		os.Exit(1)
+	}
+
+	var quotaBytes int64
+	if *quota != "" {
+		quotaBytes, err = chord.ParseSize(*quota)
+		if err != nil {
+			fmt.Println("-quota should be a size such as 512M or 10G")
+			os.Exit(1)
+		}
+	}
+	if *quotaObjects < 0 {
+		fmt.Println("-quota-objects should not be negative")
+		os.Exit(1)
+	}
+
+	var maxSizeBytes int64
+	if *maxSize != "" {
+		maxSizeBytes, err = chord.ParseSize(*maxSize)
+		if err != nil {
+			fmt.Println("-max-size should be a size such as 64M")
+			os.Exit(1)
+		}
+	}
+	if *maxConns < 0 || *lookupRate < 0 || *storeRate < 0 {
+		fmt.Println("-max-conns, -lookup-rate and -store-rate should not be negative")
+		os.Exit(1)
+	}
+
+	if *ca != "" {
+		err = chord.UseClusterCA(*ca)
+		if err != nil {
+			fmt.Println("failed to load cluster CA: ", err)
+			os.Exit(1)
+		}
+	}
+
+	// Every node gets its own key, even when several nodes run in the same directory
+	if *certDir == "" {
+		*certDir = "certs-" + chord.Hash(fmt.Sprintf("%s:%d", *a, *p)).String()
+	}
+	if *certPath == "" {
+		*certPath = filepath.Join(*certDir, "cert.pem")
+	}
+	if *keyPath == "" {
+		*keyPath = filepath.Join(*certDir, "key.pem")
+	}
+	chord.SetCertificate(*certPath, *keyPath)
+
+	// Files are encrypted with the key file, or with a passphrase from the environment
+	var key *chord.EncryptionKey
+	if *keyfile != "" {
+		key, err = chord.LoadKeyFile(*keyfile)
+		if err != nil {
+			fmt.Println("failed to load key file: ", err)
+			os.Exit(1)
+		}
+	} else if passphrase := os.Getenv("CHORD_PASSPHRASE"); passphrase != "" {
+		key = chord.PassphraseKey(passphrase)
+	}
+
+	bootstrap, err := bootstrapAddresses(*ja, *jp, *seeds)
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
@@ -67,22 +154,127 @@ func main() {
 	node.R = *r
 	node.ID = chord.Hash(*&node.Address).String()
 	node.TLSAddress = fmt.Sprintf("0.0.0.0:%d", *tls)
+	if *tls == 0 || *tls == *p {
+		// Files are transferred on the chord port, at the address other nodes know the node by
+		node.SinglePort = true
+		node.TLSAddress = node.Address
+	}
 	node.StoragePath = "storage-" + chord.Hash(*&node.Address).String()
-	err = os.Mkdir(node.StoragePath, 0755)
+	node.StatePath = "state-" + chord.Hash(*&node.Address).String() + ".json"
+	node.CheckpointInterval = *cp
+	node.SweepInterval = *sw
+	node.Replicas = *n
+	node.WriteQuorum = *w
+	node.ReadQuorum = *rq
+	node.QuotaBytes = quotaBytes
+	node.QuotaObjects = *quotaObjects
+	node.MaxConnections = *maxConns
+	node.LookupRate = *lookupRate
+	node.StoreRate = *storeRate
+	node.MaxRequestSize = maxSizeBytes
+	err = os.MkdirAll(node.StoragePath, 0755)
 	if err != nil {
 		log.Println("Failed to create storage directory: ", err)
 	}
+	store := chord.NewFSStore(node.StoragePath)
+	migrated, err := store.Migrate()
+	if err != nil {
+		log.Println("Failed to migrate storage directory: ", err)
+	}
+	if migrated > 0 {
+		log.Printf("Migrated %d files to hashed file names\n", migrated)
+	}
+	node.Storage = store
+	err = node.BuildIndex()
+	if err != nil {
+		log.Println("Failed to index storage directory: ", err)
+	}
+
+	err = chord.EnsureCertificate(node.Address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	go node.TLSListen()
 	node.CreateNode()
-	if *jp != 0 && *ja != "" {
-		j := fmt.Sprintf("%s:%d", *ja, *jp)
-		go node.Join(j)
-	} else {
 
+	// Previously known peers are tried before the bootstrap addresses
+	known, err := node.LoadState()
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("Failed to load node state: ", err)
+	}
+	bootstrap = append(known, bootstrap...)
+
+	if len(bootstrap) > 0 {
+		go node.Join(bootstrap)
+	} else {
 		go node.Start()
 	}
 
-	cli := chord.CLI{Node: &node}
+	// Certificates are reloaded on SIGHUP, and every few seconds if the files changed
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			node.ReloadCertificate()
+		}
+	}()
+
+	cli := chord.CLI{Node: &node, Key: key}
 	cli.ReadCommands(&node)
 }
+
+// Collects the join addresses from the -ja/-jp flags and the seed file.
+func bootstrapAddresses(ja string, jp int, seedFile string) ([]string, error) {
+	var entries []string
+	if ja != "" {
+		entries = append(entries, strings.Split(ja, ",")...)
+	}
+	if seedFile != "" {
+		seeds, err := readSeedFile(seedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read seed file: %w", err)
+		}
+		entries = append(entries, seeds...)
+	}
+
+	var addresses []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			if jp == 0 {
+				return nil, fmt.Errorf("join address %s has no port and -jp is not set", entry)
+			}
+			host, port = entry, fmt.Sprint(jp)
+		}
+		if !ipv4Regex.MatchString(host) {
+			return nil, fmt.Errorf("join address %s should be a valid IPv4 address", entry)
+		}
+		addresses = append(addresses, net.JoinHostPort(host, port))
+	}
+	return addresses, nil
+}
+
+// Reads a seed file with one join address per line. Empty lines and lines starting with # are skipped.
+func readSeedFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, scanner.Err()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSeedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds")
+	err := os.WriteFile(path, []byte("# seeds of the ring\n10.0.0.1:8080\n\n  10.0.0.2  \n# 10.0.0.3:8080\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds, err := readSeedFile(path)
+	if err != nil || strings.Join(seeds, ",") != "10.0.0.1:8080,10.0.0.2" {
+		t.Fatalf("readSeedFile() = %v, %v", seeds, err)
+	}
+
+	_, err = readSeedFile(filepath.Join(t.TempDir(), "missing"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("readSeedFile() of a missing file error = %v, want not exist", err)
+	}
+}
+
+func TestBootstrapAddresses(t *testing.T) {
+	seedFile := filepath.Join(t.TempDir(), "seeds")
+	err := os.WriteFile(seedFile, []byte("10.0.0.3:9090\n10.0.0.4\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ja       string
+		jp       int
+		seedFile string
+		want     string
+		wantErr  bool
+	}{
+		{"none", "", 0, "", "", false},
+		{"flags", "10.0.0.1:8080", 0, "", "10.0.0.1:8080", false},
+		{"default port", "10.0.0.1, 10.0.0.2:9090", 8080, "", "10.0.0.1:8080,10.0.0.2:9090", false},
+		{"flags before seeds", "10.0.0.1", 8080, seedFile, "10.0.0.1:8080,10.0.0.3:9090,10.0.0.4:8080", false},
+		{"empty entries", "10.0.0.1:8080,,", 0, "", "10.0.0.1:8080", false},
+		{"missing port", "10.0.0.1", 0, "", "", true},
+		{"seed without port", "", 0, seedFile, "", true},
+		{"invalid address", "node-a:8080", 0, "", "", true},
+		{"missing seed file", "", 0, filepath.Join(t.TempDir(), "missing"), "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addresses, err := bootstrapAddresses(test.ja, test.jp, test.seedFile)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("bootstrapAddresses() error = %v, want error %v", err, test.wantErr)
+			}
+			if got := strings.Join(addresses, ","); got != test.want {
+				t.Fatalf("bootstrapAddresses() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}